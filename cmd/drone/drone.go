@@ -12,6 +12,7 @@ import (
 
 	"github.com/drone/drone/pkg/build"
 	"github.com/drone/drone/pkg/build/docker"
+	"github.com/drone/drone/pkg/build/git"
 	"github.com/drone/drone/pkg/build/log"
 	"github.com/drone/drone/pkg/build/repo"
 	"github.com/drone/drone/pkg/build/script"
@@ -34,6 +35,10 @@ var (
 	// build will run in a privileged container
 	privileged = flag.Bool("privileged", false, "")
 
+	// build will run without creating a build image,
+	// mounting the source code from the host machine
+	mount = flag.Bool("mount", false, "")
+
 	// runs Drone with verbose output if True
 	verbose = flag.Bool("v", false, "")
 
@@ -162,9 +167,9 @@ func run(path string) {
 		code.Dir = filepath.Base(dir)
 	}
 
-	// this is where the code gets uploaded to the container
-	// TODO move this code to the build package
-	code.Dir = filepath.Join("/var/cache/drone/src", filepath.Clean(code.Dir))
+	// this is where the code gets uploaded to the container,
+	// unless a different path is specified in the .drone.yml
+	code.Dir = git.GitPath(s.Git, code.Dir)
 
 	// track all build results
 	var builders []*build.Builder
@@ -180,10 +185,12 @@ func run(path string) {
 		}
 	}
 
-	builds := []*script.Build{s}
+	// expand the build matrix, if one is
+	// specified, into a list of builds
+	builds := s.Builds()
 
 	// loop through and create builders
-	for _, b := range builds { //script.Builds {
+	for _, b := range builds {
 		builder := build.New(dockerClient)
 		builder.Build = b
 		builder.Repo = &code
@@ -191,6 +198,7 @@ func run(path string) {
 		builder.Stdout = os.Stdout
 		builder.Timeout = *timeout
 		builder.Privileged = *privileged
+		builder.Mount = *mount
 
 		if *parallel == true {
 			var buf bytes.Buffer
@@ -290,6 +298,7 @@ The commands are:
   --parallel       runs drone build tasks in parallel
   --timeout=300ms  timeout build after 300 milliseconds
   --privileged     runs drone build in a privileged container
+  --mount          runs drone build without creating a build image
 
 Examples:
   drone build                 builds the source in the pwd
@@ -47,6 +47,10 @@ var (
 	// this will default to 500 minutes (6 hours)
 	timeout time.Duration
 
+	// builds will run without creating a build image,
+	// mounting the build files from the host machine.
+	mount bool
+
 	// commit sha for the current build.
 	version string
 )
@@ -60,6 +64,7 @@ func main() {
 	flag.StringVar(&sslcert, "sslcert", "", "")
 	flag.StringVar(&sslkey, "sslkey", "", "")
 	flag.DurationVar(&timeout, "timeout", 300*time.Minute, "")
+	flag.BoolVar(&mount, "mount", false, "")
 	flag.Parse()
 
 	// validate the TLS arguments
@@ -134,10 +139,11 @@ func setupStatic() {
 
 // setup routes for serving dynamic content.
 func setupHandlers() {
-	queueRunner := queue.NewBuildRunner(docker.New(), timeout)
+	queueRunner := queue.NewBuildRunner(docker.New(), timeout, mount)
 	queue := queue.Start(runtime.NumCPU(), queueRunner)
 
 	hookHandler := handler.NewHookHandler(queue)
+	queueHandler := handler.NewQueueHandler(queue)
 
 	m := pat.New()
 	m.Get("/login", handler.ErrorHandler(handler.Login))
@@ -153,12 +159,17 @@ func setupHandlers() {
 	m.Post("/register", handler.ErrorHandler(handler.RegisterPost))
 	m.Get("/accept", handler.UserHandler(handler.TeamMemberAccept))
 
-	// handlers for setting up your GitHub repository
+	// handlers for setting up your GitHub, Bitbucket or git repository
 	m.Post("/new/github.com", handler.UserHandler(handler.RepoCreateGithub))
 	m.Get("/new/github.com", handler.UserHandler(handler.RepoAdd))
+	m.Post("/new/bitbucket.org", handler.UserHandler(handler.RepoCreateBitbucket))
+	m.Get("/new/bitbucket.org", handler.UserHandler(handler.RepoAddBitbucket))
+	m.Post("/new/custom", handler.UserHandler(handler.RepoCreateCustom))
+	m.Get("/new/custom", handler.UserHandler(handler.RepoAddCustom))
 
-	// handlers for linking your GitHub account
+	// handlers for linking your GitHub or Bitbucket account
 	m.Get("/auth/login/github", handler.UserHandler(handler.LinkGithub))
+	m.Get("/auth/login/bitbucket", handler.UserHandler(handler.LinkBitbucket))
 
 	// handlers for dashboard pages
 	m.Get("/dashboard/team/:team", handler.UserHandler(handler.TeamShow))
@@ -174,6 +185,10 @@ func setupHandlers() {
 	m.Get("/account/user/teams/add", handler.UserHandler(handler.TeamAdd))
 	m.Post("/account/user/teams/add", handler.UserHandler(handler.TeamCreate))
 	m.Get("/account/user/teams", handler.UserHandler(handler.UserTeams))
+	m.Get("/account/user/tokens", handler.UserHandler(handler.UserTokens))
+	m.Post("/account/user/tokens/delete", handler.UserHandler(handler.UserTokenDelete))
+	m.Post("/account/user/tokens", handler.UserHandler(handler.UserTokenCreate))
+	m.Post("/account/user/token", handler.UserHandler(handler.UserTokenReset))
 
 	// handlers for team managements
 	m.Get("/account/team/:team/profile", handler.UserHandler(handler.TeamEdit))
@@ -196,10 +211,29 @@ func setupHandlers() {
 	m.Get("/account/admin/users/add", handler.AdminHandler(handler.AdminUserAdd))
 	m.Post("/account/admin/users", handler.AdminHandler(handler.AdminUserInvite))
 	m.Get("/account/admin/users", handler.AdminHandler(handler.AdminUserList))
+	m.Post("/account/admin/queue/cancel", handler.AdminHandler(queueHandler.AdminQueueCancel))
+	m.Get("/account/admin/queue", handler.AdminHandler(queueHandler.AdminQueue))
+
+	// handlers for the JSON API
+	m.Get("/api/v1/user/repos", handler.APIHandler(handler.APIUserRepos))
+	m.Get("/api/v1/teams/:team/repos", handler.APIHandler(handler.APITeamRepos))
+	m.Get("/api/v1/repos/:host/:owner/:name/commits/:commit/builds/:label/log", handler.APIRepoHandler(handler.APIBuildLog))
+	m.Get("/api/v1/repos/:host/:owner/:name/commits/:commit/builds/:label", handler.APIRepoHandler(handler.APIBuild))
+	m.Get("/api/v1/repos/:host/:owner/:name/commits/:commit", handler.APIRepoHandler(handler.APICommit))
+	m.Get("/api/v1/repos/:host/:owner/:name/commits", handler.APIRepoHandler(handler.APICommits))
+	m.Post("/api/v1/repos/:host/:owner/:name/activate", handler.APIRepoHandler(handler.APIRepoActivate))
+	m.Post("/api/v1/repos/:host/:owner/:name/deactivate", handler.APIRepoHandler(handler.APIRepoDeactivate))
+	m.Get("/api/v1/repos/:host/:owner/:name", handler.APIRepoHandler(handler.APIRepo))
 
 	// handlers for GitHub post-commit hooks
 	m.Post("/hook/github.com", handler.ErrorHandler(hookHandler.Hook))
 
+	// handlers for Bitbucket post-commit hooks
+	m.Post("/hook/bitbucket.org", handler.ErrorHandler(hookHandler.HookBitbucket))
+
+	// handlers for custom git server post-receive hooks
+	m.Post("/hook/custom", handler.ErrorHandler(hookHandler.HookCustom))
+
 	// handlers for first-time installation
 	m.Get("/install", handler.ErrorHandler(handler.Install))
 	m.Post("/install", handler.ErrorHandler(handler.InstallPost))
@@ -207,10 +241,15 @@ func setupHandlers() {
 	// handlers for repository, commits and build details
 	m.Get("/:host/:owner/:name/commit/:commit/build/:label/out.txt", handler.RepoHandler(handler.BuildOut))
 	m.Get("/:host/:owner/:name/commit/:commit/build/:label", handler.RepoHandler(handler.CommitShow))
+	m.Post("/:host/:owner/:name/commit/:commit/build/:label/cancel", handler.RepoAdminHandler(queueHandler.BuildCancel))
 	m.Get("/:host/:owner/:name/commit/:commit", handler.RepoHandler(handler.CommitShow))
+	m.Post("/:host/:owner/:name/commit/:commit/restart", handler.RepoAdminHandler(queueHandler.CommitRestart))
+	m.Post("/:host/:owner/:name/commit/:commit/approve", handler.RepoWriteHandler(queueHandler.CommitApprove))
 	m.Get("/:host/:owner/:name/tree", handler.RepoHandler(handler.RepoDashboard))
+	m.Post("/:host/:owner/:name/build", handler.RepoAdminHandler(queueHandler.RepoBuild))
 	m.Get("/:host/:owner/:name/status.svg", handler.ErrorHandler(handler.Badge))
 	m.Get("/:host/:owner/:name/settings", handler.RepoAdminHandler(handler.RepoSettingsForm))
+	m.Post("/:host/:owner/:name/settings/secret", handler.RepoAdminHandler(handler.RepoHookSecretReset))
 	m.Get("/:host/:owner/:name/params", handler.RepoAdminHandler(handler.RepoParamsForm))
 	m.Get("/:host/:owner/:name/badges", handler.RepoAdminHandler(handler.RepoBadges))
 	m.Get("/:host/:owner/:name/keys", handler.RepoAdminHandler(handler.RepoKeys))
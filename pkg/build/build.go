@@ -14,7 +14,6 @@ import (
 	"github.com/drone/drone/pkg/build/docker"
 	"github.com/drone/drone/pkg/build/dockerfile"
 	"github.com/drone/drone/pkg/build/log"
-	"github.com/drone/drone/pkg/build/proxy"
 	"github.com/drone/drone/pkg/build/repo"
 	"github.com/drone/drone/pkg/build/script"
 )
@@ -27,11 +26,19 @@ type BuildState struct {
 	Finished int64
 	ExitCode int
 
+	// MergeConflict indicates the Pull Request
+	// can't be merged into the base branch.
+	MergeConflict bool
+
 	// we may eventually include detailed resource
 	// usage statistics, including including CPU time,
 	// Max RAM, Max Swap, Disk space, and more.
 }
 
+// errKilled is returned by setup when the build
+// is killed before the setup is done.
+var errKilled = fmt.Errorf("Error: build killed")
+
 func New(dockerClient *docker.Client) *Builder {
 	return &Builder{
 		dockerClient: dockerClient,
@@ -65,6 +72,32 @@ type Builder struct {
 	// mode. The default is false.
 	Privileged bool
 
+	// Memory is the memory limit, in bytes, of the build container.
+	// The default is zero, which means no limit.
+	Memory int64
+
+	// CpuShares is the relative CPU weight of the build container
+	// versus other containers. The default is zero, which means
+	// the Docker default weight is used.
+	CpuShares int64
+
+	// Mirror indicates a bare mirror of the repository should
+	// be kept on the host machine, and mounted in the build
+	// container, so that the repository can be cloned using
+	// the mirror as a reference. The default is false.
+	Mirror bool
+
+	// Mount indicates the build image should not be
+	// created, and the stock image is run directly with
+	// the build script, key and source code mounted from
+	// the host machine. The default is false.
+	Mount bool
+
+	// Cancel is a channel used to kill the build. The build
+	// is stopped when a value is sent or the channel is closed.
+	// The default is nil, which never kills the build.
+	Cancel <-chan bool
+
 	// Stdout specifies the builds's standard output.
 	//
 	// If stdout is nil, Run connects the corresponding file descriptor
@@ -88,21 +121,54 @@ type Builder struct {
 	// this build.
 	services []*docker.Container
 
+	// Configuration of the service containers,
+	// with preset services resolved.
+	serviceConfs []*script.Service
+
+	// Indicates the build and service containers
+	// share the network namespace of the first
+	// service container.
+	shared bool
+
+	// Entries added to /etc/hosts, in the
+	// hostname:ip format.
+	hosts []string
+
+	// Path of the repository mirror on the
+	// host machine, if one is used.
+	mirror string
+
+	// Path of the directory on the host machine
+	// that is mounted in the build container, if
+	// the build image isn't created.
+	mount string
+
 	dockerClient *docker.Client
 }
 
 func (b *Builder) Run() error {
+	// setup will create the Image and supporting
+	// service containers. If the build is killed,
+	// setup stops before its next step, for example
+	// before the image is downloaded.
+	if err := b.setup(); err != nil || b.killed() {
+		b.teardown()
+		if !b.killed() {
+			return err
+		}
+		log.Errf("killed build %s", b.Build.Name)
+		b.BuildState = &BuildState{}
+		b.BuildState.ExitCode = 137
+		b.BuildState.Started = time.Now().UTC().Unix()
+		b.BuildState.Finished = b.BuildState.Started
+		return nil
+	}
+
 	// teardown will remove the Image and stop and
 	// remove the service containers after the
 	// build is done running.
 	defer b.teardown()
 
-	// setup will create the Image and supporting
-	// service containers.
-	if err := b.setup(); err != nil {
-		return err
-	}
-
 	// make sure build state is not nil
 	b.BuildState = &BuildState{}
 	b.BuildState.ExitCode = 0
@@ -113,7 +179,8 @@ func (b *Builder) Run() error {
 		c <- b.run()
 	}()
 
-	// wait for either a) the job to complete or b) the job to timeout
+	// wait for either a) the job to complete, b) the job to timeout
+	// or c) the job to be killed
 	select {
 	case err := <-c:
 		return err
@@ -122,6 +189,11 @@ func (b *Builder) Run() error {
 		b.BuildState.ExitCode = 124
 		b.BuildState.Finished = time.Now().UTC().Unix()
 		return nil
+	case <-b.Cancel:
+		log.Errf("killed build %s", b.Build.Name)
+		b.BuildState.ExitCode = 137
+		b.BuildState.Finished = time.Now().UTC().Unix()
+		return nil
 	}
 }
 
@@ -150,8 +222,9 @@ func (b *Builder) setup() error {
 	}
 
 	// if this is a local repository we should symlink
-	// to the source code in our temp directory
-	if b.Repo.IsLocal() {
+	// to the source code in our temp directory, unless
+	// the source code is mounted in the build container.
+	if b.Repo.IsLocal() && !b.Mount {
 		// this is where we used to use symlinks. We should
 		// talk to the docker team about this, since copying
 		// the entire repository is slow :(
@@ -171,19 +244,31 @@ func (b *Builder) setup() error {
 		}
 	}
 
+	// resolve the services required for the build. A
+	// service must be a preset, or list the ports it
+	// listens on.
+	var confs []*script.Service
+	for _, service := range b.Build.Services {
+		if _, ok := services[service.Image]; !ok && len(service.Ports) == 0 {
+			return fmt.Errorf("Error: Invalid or unknown service %s", service.Image)
+		}
+		confs = append(confs, resolveService(service))
+	}
+	b.shared = b.canShareNetwork(confs)
+	b.hosts = b.resolveHosts(confs)
+
 	// start all services required for the build
 	// that will get linked to the container.
-	for _, service := range b.Build.Services {
-		image, ok := services[service]
-		if !ok {
-			return fmt.Errorf("Error: Invalid or unknown service %s", service)
+	for _, service := range confs {
+		if b.killed() {
+			return errKilled
 		}
 
 		// debugging
-		log.Infof("starting service container %s", image.Tag)
+		log.Infof("starting service container %s", service.Image)
 
 		// Run the contianer
-		run, err := b.dockerClient.Containers.RunDaemonPorts(image.Tag, image.Ports...)
+		run, err := b.runService(service)
 		if err != nil {
 			return err
 		}
@@ -199,9 +284,67 @@ func (b *Builder) setup() error {
 			return err
 		}
 
+		// containers that join the network namespace of
+		// the first service share its IP address.
+		if b.shared && len(b.services) != 0 {
+			info.NetworkSettings = b.services[0].NetworkSettings
+		}
+
 		// Add the running service to the list
 		b.services = append(b.services, info)
+		b.serviceConfs = append(b.serviceConfs, service)
+
+	}
+
+	// wait for the services to become ready, so that
+	// the build doesn't fail while they are starting.
+	if err := b.waitServices(); err != nil {
+		return err
+	}
+
+	if b.killed() {
+		return errKilled
+	}
+
+	// update the mirror of the repository. If the mirror
+	// can't be updated, or git isn't installed on the host
+	// machine, we clone from the remote repository.
+	if b.Mirror && b.Repo.IsRemote() && b.Repo.IsGit() && hasGit() {
+		if path, err := b.updateMirror(); err != nil {
+			log.Errf("unable to use repository mirror. %s", err)
+		} else {
+			b.mirror = path
+			b.Repo.Mirror = mirrorDir
+		}
+	}
+
+	// check for build container (ie bradrydzewski/go:1.2)
+	// and download if it doesn't already exist
+	image, err := b.dockerClient.Images.Inspect(b.Build.Image)
+	if err == docker.ErrNotFound {
+		if b.killed() {
+			return errKilled
+		}
+
+		// download the image if it doesn't exist
+		if err := b.dockerClient.Images.Pull(b.Build.Image); err != nil {
+			return err
+		}
+		image, err = b.dockerClient.Images.Inspect(b.Build.Image)
+	}
+	if err != nil {
+		return err
+	}
 
+	// inspect the image to determine the user, home
+	// directory and shell used to run the build.
+	b.resolveUser(image)
+
+	// write the build files to a directory that is
+	// mounted in the container, instead of creating
+	// the build image.
+	if b.Mount {
+		return b.writeMountDir()
 	}
 
 	if err := b.writeIdentifyFile(dir); err != nil {
@@ -212,7 +355,7 @@ func (b *Builder) setup() error {
 		return err
 	}
 
-	if err := b.writeProxyScript(dir); err != nil {
+	if err := b.writeChangedFiles(dir); err != nil {
 		return err
 	}
 
@@ -220,18 +363,13 @@ func (b *Builder) setup() error {
 		return err
 	}
 
+	if b.killed() {
+		return errKilled
+	}
+
 	// debugging
 	log.Info("creating build image")
 
-	// check for build container (ie bradrydzewski/go:1.2)
-	// and download if it doesn't already exist
-	if _, err := b.dockerClient.Images.Inspect(b.Build.Image); err == docker.ErrNotFound {
-		// download the image if it doesn't exist
-		if err := b.dockerClient.Images.Pull(b.Build.Image); err != nil {
-			return err
-		}
-	}
-
 	// create the Docker image
 	id := createUID()
 	if err := b.dockerClient.Images.Build(id, dir); err != nil {
@@ -253,6 +391,17 @@ func (b *Builder) setup() error {
 	return nil
 }
 
+// killed is a helper function that returns true
+// if the build was killed.
+func (b *Builder) killed() bool {
+	select {
+	case <-b.Cancel:
+		return true
+	default:
+		return false
+	}
+}
+
 // teardown is a helper function that we can use to
 // stop and remove the build container, its supporting image,
 // and the supporting service containers.
@@ -276,7 +425,7 @@ func (b *Builder) teardown() error {
 	// stop and destroy the container services
 	for i, container := range b.services {
 		// debugging
-		log.Infof("removing service container %s", b.Build.Services[i])
+		log.Infof("removing service container %s", b.Build.Services[i].Image)
 
 		// stop the service container, ignore the error
 		b.dockerClient.Containers.Stop(container.ID, 15)
@@ -287,6 +436,13 @@ func (b *Builder) teardown() error {
 		}
 	}
 
+	// remove the mounted directory
+	if len(b.mount) != 0 {
+		if err := os.RemoveAll(b.mount); err != nil {
+			log.Errf("failed to delete build directory %s. %s", b.mount, err.Error())
+		}
+	}
+
 	// destroy the underlying image
 	if b.image != nil {
 		// debugging
@@ -303,10 +459,23 @@ func (b *Builder) teardown() error {
 func (b *Builder) run() error {
 	// create and run the container
 	conf := docker.Config{
-		Image:        b.image.ID,
 		AttachStdin:  false,
 		AttachStdout: true,
 		AttachStderr: true,
+		Memory:       b.Memory,
+		CpuShares:    b.CpuShares,
+	}
+
+	// without a build image the stock image is run,
+	// configured as the build image would have been.
+	if b.Mount {
+		conf.Image = b.Build.Image
+		conf.User = "root"
+		conf.Env = b.containerEnv()
+		conf.WorkingDir = b.Repo.Dir
+		conf.Entrypoint = []string{"/bin/sh", filepath.Join(mountDir, "entrypoint")}
+	} else {
+		conf.Image = b.image.ID
 	}
 
 	// configure if Docker should run in privileged mode
@@ -317,23 +486,27 @@ func (b *Builder) run() error {
 	// debugging
 	log.Noticef("starting build %s", b.Build.Name)
 
-	// link service containers
+	// link service containers, or join the network
+	// namespace of the first service container.
 	for i, service := range b.services {
-		image, ok := services[b.Build.Services[i]]
-		if !ok {
-			continue // THIS SHOULD NEVER HAPPEN
+		if b.shared {
+			host.NetworkMode = "container:" + b.services[0].ID
+			break
 		}
 		// link the service container to our
 		// build container.
-		host.Links = append(host.Links, service.Name[1:]+":"+image.Name)
+		host.Links = append(host.Links, service.Name[1:]+":"+b.serviceConfs[i].Alias)
 	}
 
-	// where are temp files going to go?
-	tmpPath := "/tmp/drone"
-	if len(os.Getenv("DRONE_TMP")) > 0 {
-		tmpPath = os.Getenv("DRONE_TMP")
+	// the /etc/hosts entries are added to the container
+	// that owns the network namespace.
+	if len(host.NetworkMode) == 0 {
+		host.ExtraHosts = b.hosts
 	}
 
+	// where are temp files going to go?
+	tmpPath := tempPath()
+
 	log.Infof("temp directory is %s", tmpPath)
 
 	if err := os.MkdirAll(tmpPath, 0777); err != nil {
@@ -371,6 +544,22 @@ func (b *Builder) run() error {
 		log.Infof("mounting volume %s:%s", hostpath, volume)
 	}
 
+	// mount the repository mirror as read-only
+	if len(b.mirror) != 0 {
+		host.Binds = append(host.Binds, b.mirror+":"+mirrorDir+":ro")
+		conf.Volumes[mirrorDir] = struct{}{}
+
+		// debugging
+		log.Infof("mounting mirror %s:%s", b.mirror, mirrorDir)
+	}
+
+	// mount the build files and the source code
+	if b.Mount {
+		if err := b.mountBuildDir(&conf, &host); err != nil {
+			return err
+		}
+	}
+
 	// create the container from the image
 	run, err := b.dockerClient.Containers.Create(&conf)
 	if err != nil {
@@ -406,9 +595,66 @@ func (b *Builder) run() error {
 	// get the exit code if possible
 	b.BuildState.ExitCode = wait.StatusCode
 
+	// check if the build failed because the pull
+	// request can't be merged into the base branch.
+	if wait.StatusCode != 0 && b.Repo.IsMerge() {
+		b.BuildState.MergeConflict = b.mergeConflict(run.ID)
+	}
+
 	return nil
 }
 
+// mergeConflict is a helper function that returns true if
+// the merge conflict file was created in the build container,
+// indicating the Pull Request can't be merged.
+func (b *Builder) mergeConflict(id string) bool {
+	// the source code is mounted from the host machine
+	// and the file can be checked directly.
+	if b.Mount {
+		_, err := os.Stat(filepath.Join(b.mount, "src", repo.MergeConflictFile))
+		return err == nil
+	}
+
+	// the file doesn't exist if it can't be copied from
+	// the build container.
+	path := filepath.Join(b.Repo.Dir, repo.MergeConflictFile)
+	return b.dockerClient.Containers.Copy(id, path, ioutil.Discard) == nil
+}
+
+// runService is a helper function that will start the
+// service container as a daemon, exposing the ports of
+// the service.
+func (b *Builder) runService(service *script.Service) (*docker.Run, error) {
+	conf := docker.Config{
+		Image:        service.Image,
+		Env:          service.Env,
+		Cmd:          service.Command,
+		ExposedPorts: make(map[docker.Port]struct{}),
+	}
+	host := docker.HostConfig{
+		PortBindings: make(map[docker.Port][]docker.PortBinding),
+	}
+
+	// a service that joins the network namespace of
+	// the first service can't expose any ports.
+	if b.shared && len(b.services) != 0 {
+		host.NetworkMode = "container:" + b.services[0].ID
+		return b.dockerClient.Containers.RunDaemon(&conf, &host)
+	}
+
+	// the first service owns the shared network namespace,
+	// including the /etc/hosts entries of the build.
+	if b.shared {
+		host.ExtraHosts = b.hosts
+	}
+
+	for _, port := range service.Ports {
+		conf.ExposedPorts[docker.Port(port+"/tcp")] = struct{}{}
+		host.PortBindings[docker.Port(port+"/tcp")] = []docker.PortBinding{{HostIp: "127.0.0.1", HostPort: ""}}
+	}
+	return b.dockerClient.Containers.RunDaemon(&conf, &host)
+}
+
 // writeDockerfile is a helper function that generates a
 // Dockerfile and writes to the builds temporary directory
 // so that it can be used to create the Image.
@@ -423,42 +669,32 @@ func (b *Builder) writeDockerfile(dir string) error {
 		dockerfile.WriteAdd("src", filepath.Join(b.Repo.Dir))
 	}
 
-	switch {
-	case strings.HasPrefix(b.Build.Image, "bradrydzewski/"),
-		strings.HasPrefix(b.Build.Image, "drone/"):
-		// the default user for all official Drone imnage
-		// is the "ubuntu" user, since all build images
-		// inherit from the ubuntu cloud ISO
-		dockerfile.WriteUser("ubuntu")
-		dockerfile.WriteEnv("HOME", "/home/ubuntu")
-		dockerfile.WriteEnv("LANG", "en_US.UTF-8")
-		dockerfile.WriteEnv("LANGUAGE", "en_US:en")
-		dockerfile.WriteEnv("LOGNAME", "ubuntu")
-		dockerfile.WriteEnv("TERM", "xterm")
-		dockerfile.WriteEnv("SHELL", "/bin/bash")
-		dockerfile.WriteAdd("id_rsa", "/home/ubuntu/.ssh/id_rsa")
-		dockerfile.WriteRun("sudo chown -R ubuntu:ubuntu /home/ubuntu/.ssh")
-		dockerfile.WriteRun("sudo chown -R ubuntu:ubuntu /var/cache/drone")
-		dockerfile.WriteRun("sudo chown -R ubuntu:ubuntu /usr/local/bin/drone")
-		dockerfile.WriteRun("sudo chmod 600 /home/ubuntu/.ssh/id_rsa")
-	default:
-		// all other images are assumed to use
-		// the root user.
-		dockerfile.WriteUser("root")
-		dockerfile.WriteEnv("HOME", "/root")
-		dockerfile.WriteEnv("LANG", "en_US.UTF-8")
-		dockerfile.WriteEnv("LANGUAGE", "en_US:en")
-		dockerfile.WriteEnv("LOGNAME", "root")
-		dockerfile.WriteEnv("TERM", "xterm")
-		dockerfile.WriteEnv("SHELL", "/bin/bash")
-		dockerfile.WriteEnv("GOPATH", "/var/cache/drone")
-		dockerfile.WriteAdd("id_rsa", "/root/.ssh/id_rsa")
-		dockerfile.WriteRun("chmod 600 /root/.ssh/id_rsa")
-		dockerfile.WriteRun("echo 'StrictHostKeyChecking no' > /root/.ssh/config")
-	}
-
-	dockerfile.WriteAdd("proxy.sh", "/etc/drone.d/")
-	dockerfile.WriteEntrypoint("/bin/bash -e /usr/local/bin/drone")
+	// the files are added and configured by the root
+	// user, so that the image isn't required to have sudo.
+	var user, home = b.Build.User, b.Build.Home
+	dockerfile.WriteUser("root")
+	dockerfile.WriteAdd("id_rsa", filepath.Join(home, ".ssh/id_rsa"))
+	dockerfile.WriteAdd("changed_files", "/etc/drone.d/")
+	dockerfile.WriteRun(fmt.Sprintf("chmod 600 %s/.ssh/id_rsa", home))
+	dockerfile.WriteRun(fmt.Sprintf("echo 'StrictHostKeyChecking no' > %s/.ssh/config", home))
+
+	// the repository is cloned by the build user, which
+	// must own the directory the repository is cloned into.
+	// system directories are never changed.
+	if !isRoot(user) {
+		dockerfile.WriteRun(fmt.Sprintf("chown -R %s %s/.ssh /usr/local/bin/drone", user, home))
+		if !isSystemDir(b.Repo.Dir) {
+			dockerfile.WriteRun(fmt.Sprintf("mkdir -p %s", b.Repo.Dir))
+			dockerfile.WriteRun(fmt.Sprintf("chown -R %s %s", user, b.Repo.Dir))
+		}
+	}
+
+	dockerfile.WriteUser(user)
+	for _, env := range b.containerEnv() {
+		parts := strings.SplitN(env, "=", 2)
+		dockerfile.WriteEnv(parts[0], parts[1])
+	}
+	dockerfile.WriteEntrypoint(b.entrypoint("/usr/local/bin/drone"))
 
 	// write the Dockerfile to the temporary directory
 	return ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), dockerfile.Bytes(), 0700)
@@ -475,13 +711,14 @@ func (b *Builder) writeBuildScript(dir string) error {
 	f.WriteEnv("DRONE", "true")
 	f.WriteEnv("DRONE_BRANCH", b.Repo.Branch)
 	f.WriteEnv("DRONE_COMMIT", b.Repo.Commit)
+	f.WriteEnv("DRONE_TAG", b.Repo.Tag)
 	f.WriteEnv("DRONE_PR", b.Repo.PR)
+	f.WriteEnv("DRONE_PR_BASE", b.Repo.BaseCommit)
 	f.WriteEnv("DRONE_BUILD_DIR", b.Repo.Dir)
+	f.WriteEnv("DRONE_CHANGED_FILES", "/etc/drone.d/changed_files")
 
-	// add /etc/hosts entries
-	for _, mapping := range b.Build.Hosts {
-		f.WriteHost(mapping)
-	}
+	// add environment variables for the services
+	b.writeServiceEnv(f)
 
 	// if the repository is remote then we should
 	// add the commands to the build script to
@@ -492,11 +729,17 @@ func (b *Builder) writeBuildScript(dir string) error {
 		}
 	}
 
+	// change to the working directory, if it isn't
+	// the root of the repository.
+	if workdir := b.workdir(); workdir != b.Repo.Dir {
+		f.WriteCmd("cd " + workdir)
+	}
+
 	// if the commit is for merging a pull request
 	// we should only execute the build commands,
 	// and omit the deploy and publish commands.
 	if len(b.Repo.PR) == 0 {
-		b.Build.Write(f)
+		b.Build.Write(f, len(b.Repo.Tag) != 0)
 	} else {
 		// only write the build commands
 		b.Build.WriteBuild(f)
@@ -506,24 +749,17 @@ func (b *Builder) writeBuildScript(dir string) error {
 	return ioutil.WriteFile(scriptfilePath, f.Bytes(), 0700)
 }
 
-// writeProxyScript is a helper function that
-// will generate the proxy.sh file in the builder's
-// temp directory to be added to the Image.
-func (b *Builder) writeProxyScript(dir string) error {
-	var proxyfile = proxy.Proxy{}
-
-	// loop through services so that we can
-	// map ip address to localhost
-	for _, container := range b.services {
-		// create an entry for each port
-		for port := range container.NetworkSettings.Ports {
-			proxyfile.Set(port.Port(), container.NetworkSettings.IPAddress)
-		}
-	}
-
-	// write the proxyfile to the temp directory
-	proxyfilePath := filepath.Join(dir, "proxy.sh")
-	return ioutil.WriteFile(proxyfilePath, proxyfile.Bytes(), 0755)
+// writeChangedFiles is a helper function that will
+// generate the changed_files file, listing the files
+// changed by the commit, in the builder's temp directory
+// to be added to the Image.
+func (b *Builder) writeChangedFiles(dir string) error {
+	var files string
+	for _, file := range b.Repo.Files {
+		files += file + "\n"
+	}
+	filesPath := filepath.Join(dir, "changed_files")
+	return ioutil.WriteFile(filesPath, []byte(files), 0644)
 }
 
 // writeIdentifyFile is a helper function that
@@ -4,18 +4,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/drone/drone/pkg/build/buildfile"
 	"github.com/drone/drone/pkg/build/docker"
-	"github.com/drone/drone/pkg/build/proxy"
 	"github.com/drone/drone/pkg/build/repo"
 	"github.com/drone/drone/pkg/build/script"
+	"github.com/drone/drone/pkg/plugin/deploy"
 )
 
 var (
@@ -55,7 +59,7 @@ func TestSetup(t *testing.T) {
 	// This will return a dummy image ID, so that the system knows
 	// the build image exists, and doens't need to be downloaded.
 	mux.HandleFunc("/v1.9/images/bradrydzewski/go:1.2/json", func(w http.ResponseWriter, r *http.Request) {
-		body := `[{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }]`
+		body := `{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }`
 		w.Write([]byte(body))
 	})
 
@@ -116,7 +120,7 @@ func TestSetupUnknownService(t *testing.T) {
 	b.Repo.Path = "git://github.com/drone/drone.git"
 	b.Build = &script.Build{}
 	b.Build.Image = "go1.2"
-	b.Build.Services = append(b.Build.Services, "not-found")
+	b.Build.Services = append(b.Build.Services, &script.Service{Image: "not-found"})
 
 	var got, want = b.setup(), "Error: Invalid or unknown service not-found"
 	if got == nil || got.Error() != want {
@@ -139,7 +143,7 @@ func TestSetupErrorRunDaemonPorts(t *testing.T) {
 	b.Repo.Path = "git://github.com/drone/drone.git"
 	b.Build = &script.Build{}
 	b.Build.Image = "go1.2"
-	b.Build.Services = append(b.Build.Services, "mysql")
+	b.Build.Services = append(b.Build.Services, &script.Service{Image: "mysql"})
 	b.dockerClient = client
 
 	var got, want = b.setup(), docker.ErrBadRequest
@@ -173,7 +177,7 @@ func TestSetupErrorServiceInspect(t *testing.T) {
 	b.Repo.Path = "git://github.com/drone/drone.git"
 	b.Build = &script.Build{}
 	b.Build.Image = "go1.2"
-	b.Build.Services = append(b.Build.Services, "mysql")
+	b.Build.Services = append(b.Build.Services, &script.Service{Image: "mysql"})
 	b.dockerClient = client
 
 	var got, want = b.setup(), docker.ErrBadRequest
@@ -182,6 +186,159 @@ func TestSetupErrorServiceInspect(t *testing.T) {
 	}
 }
 
+// TestSetupService will test our ability to start a user-defined
+// service with a custom image, environment and command.
+func TestSetupService(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var conf docker.Config
+	mux.HandleFunc("/v1.9/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&conf)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	b := Builder{}
+	b.Repo = &repo.Repo{}
+	b.Repo.Path = "git://github.com/drone/drone.git"
+	b.Build = &script.Build{}
+	b.Build.Image = "go1.2"
+	b.Build.Services = append(b.Build.Services, &script.Service{
+		Image:   "postgres:9.3",
+		Ports:   []string{"5432"},
+		Env:     []string{"POSTGRES_DB=test"},
+		Command: []string{"postgres", "-F"}})
+	b.dockerClient = client
+	b.setup()
+
+	if conf.Image != "postgres:9.3" {
+		t.Errorf("Expected service image postgres:9.3, got %s", conf.Image)
+	}
+	if _, ok := conf.ExposedPorts["5432/tcp"]; !ok {
+		t.Errorf("Expected service port 5432 exposed, got %v", conf.ExposedPorts)
+	}
+	if len(conf.Env) != 1 || conf.Env[0] != "POSTGRES_DB=test" {
+		t.Errorf("Expected service env [POSTGRES_DB=test], got %v", conf.Env)
+	}
+	if len(conf.Cmd) != 2 || conf.Cmd[0] != "postgres" || conf.Cmd[1] != "-F" {
+		t.Errorf("Expected service command [postgres -F], got %v", conf.Cmd)
+	}
+}
+
+// TestResolveService will test our ability to resolve preset
+// services, and to derive the alias of a service.
+func TestResolveService(t *testing.T) {
+	var tests = []struct {
+		service *script.Service
+		image   string
+		alias   string
+		ports   int
+	}{
+		{&script.Service{Image: "mysql"}, "bradrydzewski/mysql:5.5", "mysql", 1},
+		{&script.Service{Image: "redis", Alias: "cache"}, "bradrydzewski/redis:2.8", "cache", 1},
+		{&script.Service{Image: "postgres:9.3", Ports: []string{"5432"}}, "postgres:9.3", "postgres", 1},
+		{&script.Service{Image: "localhost:5000/acme/api:1.0", Ports: []string{"80", "443"}}, "localhost:5000/acme/api:1.0", "api", 2},
+	}
+
+	for _, test := range tests {
+		service := resolveService(test.service)
+		if service.Image != test.image {
+			t.Errorf("Expected image %s, got %s", test.image, service.Image)
+		}
+		if service.Alias != test.alias {
+			t.Errorf("Expected alias %s, got %s", test.alias, service.Alias)
+		}
+		if len(service.Ports) != test.ports {
+			t.Errorf("Expected %d ports, got %v", test.ports, service.Ports)
+		}
+	}
+}
+
+// TestWaitService will test our ability to wait for a service
+// to accept TCP connections or HTTP requests, and to fail when
+// the service never becomes ready.
+func TestWaitService(t *testing.T) {
+	readyInterval = 10 * time.Millisecond
+	defer func() { readyInterval = time.Second }()
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	c := &docker.Container{
+		NetworkSettings: &docker.NetworkSettings{IPAddress: host},
+	}
+
+	var buf bytes.Buffer
+	b := Builder{Stdout: &buf}
+
+	// the service is ready once the port accepts connections
+	service := &script.Service{Alias: "web", Ports: []string{port}}
+	if err := b.waitService(service, c); err != nil {
+		t.Errorf("Expected service ready, got %s", err)
+	}
+	if !strings.Contains(buf.String(), "service web is ready") {
+		t.Errorf("Expected progress in build output, got %s", buf.String())
+	}
+
+	// the service is never ready if the request fails
+	service.Ready = &script.Ready{HTTP: "/health", Timeout: 1}
+	err := b.waitService(service, c)
+	if err == nil || !strings.Contains(err.Error(), "service web never became ready") {
+		t.Errorf("Expected service never became ready, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "service web never became ready") {
+		t.Errorf("Expected error in build output, got %s", buf.String())
+	}
+
+	// the wait stops when the build is killed
+	cancel := make(chan bool)
+	close(cancel)
+	b.Cancel = cancel
+	service.Ready.Timeout = 60
+	err = b.waitService(service, c)
+	if err == nil || !strings.Contains(err.Error(), "build killed while waiting for service web") {
+		t.Errorf("Expected wait stopped when the build is killed, got %v", err)
+	}
+}
+
+// TestCheckServiceCommand will test our ability to check that a
+// service is ready by running a command inside the container.
+func TestCheckServiceCommand(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var cmd []string
+	mux.HandleFunc("/v1.9/containers/e90e34656806/exec", func(w http.ResponseWriter, r *http.Request) {
+		conf := docker.ExecConfig{}
+		json.NewDecoder(r.Body).Decode(&conf)
+		cmd = conf.Cmd
+		w.Write([]byte(`{ "Id":"1e9b30f1b2" }`))
+	})
+
+	mux.HandleFunc("/v1.9/exec/1e9b30f1b2/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/v1.9/exec/1e9b30f1b2/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "ID":"1e9b30f1b2", "Running":false, "ExitCode":1 }`))
+	})
+
+	b := Builder{}
+	b.dockerClient = client
+
+	c := &docker.Container{ID: "e90e34656806"}
+	service := &script.Service{Alias: "mysql", Ready: &script.Ready{Command: []string{"mysqladmin", "ping"}}}
+
+	err := b.checkService(service, c)
+	if err == nil || err.Error() != "Command exited with status 1" {
+		t.Errorf("Expected command exited with status 1, got %v", err)
+	}
+	if len(cmd) != 2 || cmd[0] != "mysqladmin" || cmd[1] != "ping" {
+		t.Errorf("Expected command [mysqladmin ping], got %v", cmd)
+	}
+}
+
 // TestSetupErrorImagePull will test our ability to handle a
 // failure when a the build image cannot be pulled from the index.
 func TestSetupErrorImagePull(t *testing.T) {
@@ -218,7 +375,7 @@ func TestSetupErrorBuild(t *testing.T) {
 	defer teardown()
 
 	mux.HandleFunc("/v1.9/images/bradrydzewski/go:1.2/json", func(w http.ResponseWriter, r *http.Request) {
-		body := `[{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }]`
+		body := `{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }`
 		w.Write([]byte(body))
 	})
 
@@ -248,7 +405,7 @@ func TestSetupErrorBuildInspect(t *testing.T) {
 	defer teardown()
 
 	mux.HandleFunc("/v1.9/images/bradrydzewski/go:1.2/json", func(w http.ResponseWriter, r *http.Request) {
-		body := `[{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }]`
+		body := `{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }`
 		w.Write([]byte(body))
 	})
 
@@ -318,7 +475,7 @@ func TestTeardown(t *testing.T) {
 	b.services = append(b.services, &docker.Container{ID: "ec62dcc736"})
 	b.container = &docker.Run{ID: "7bf9ce0ffb"}
 	b.image = &docker.Image{ID: "c3ab8ff137"}
-	b.Build = &script.Build{Services: []string{"mysql"}}
+	b.Build = &script.Build{Services: []*script.Service{{Image: "mysql"}}}
 	b.teardown()
 
 	if !containerStopped {
@@ -346,6 +503,49 @@ func TestRun(t *testing.T) {
 	t.Skip()
 }
 
+// TestRunCancelSetup will test our ability to kill a build
+// while the setup is still running, for example when the
+// image is downloaded.
+func TestRunCancelSetup(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the build is killed while the setup inspects
+	// the image, so the image is never downloaded.
+	cancel := make(chan bool)
+	pulled := false
+
+	mux.HandleFunc("/v1.9/images/bradrydzewski/go:1.2/json", func(w http.ResponseWriter, r *http.Request) {
+		close(cancel)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	mux.HandleFunc("/v1.9/images/create", func(w http.ResponseWriter, r *http.Request) {
+		pulled = true
+	})
+
+	b := Builder{}
+	b.Repo = &repo.Repo{}
+	b.Repo.Path = "git://github.com/drone/drone.git"
+	b.Build = &script.Build{}
+	b.Build.Image = "go1.2"
+	b.Timeout = time.Minute
+	b.Cancel = cancel
+	b.dockerClient = client
+
+	if err := b.Run(); err != nil {
+		t.Errorf("Expected killed build without error, got %s", err)
+	}
+
+	if b.BuildState == nil || b.BuildState.ExitCode != 137 {
+		t.Errorf("Expected exit code 137 for a killed build, got %v", b.BuildState)
+	}
+
+	if pulled {
+		t.Errorf("Expected image not downloaded once the build is killed")
+	}
+}
+
 func TestRunPrivileged(t *testing.T) {
 	setup()
 	defer teardown()
@@ -393,6 +593,225 @@ func TestRunPrivileged(t *testing.T) {
 	}
 }
 
+// TestRunResources will test that the memory limit and CPU
+// weight are applied to the build container.
+func TestRunResources(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var conf = docker.Config{}
+
+	mux.HandleFunc("/v1.9/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&conf)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	b := Builder{}
+	b.BuildState = &BuildState{}
+	b.dockerClient = client
+	b.Stdout = new(bytes.Buffer)
+	b.image = &docker.Image{ID: "c3ab8ff137"}
+	b.Build = &script.Build{}
+	b.Repo = &repo.Repo{}
+	b.Memory = 536870912
+	b.CpuShares = 512
+	b.run()
+
+	if conf.Memory != 536870912 {
+		t.Errorf("Expected container memory limit 536870912, got %d", conf.Memory)
+	}
+	if conf.CpuShares != 512 {
+		t.Errorf("Expected container CPU shares 512, got %d", conf.CpuShares)
+	}
+}
+
+// TestSetupMount will test our ability to setup a build
+// without creating a build image, writing the build files
+// to a directory that is mounted in the build container.
+func TestSetupMount(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir, _ := ioutil.TempDir("", "drone-test-")
+	defer os.RemoveAll(dir)
+
+	tmp := os.Getenv("DRONE_TMP")
+	os.Setenv("DRONE_TMP", dir)
+	defer os.Setenv("DRONE_TMP", tmp)
+
+	mux.HandleFunc("/v1.9/images/bradrydzewski/go:1.2/json", func(w http.ResponseWriter, r *http.Request) {
+		body := `{ "id": "7bf9ce0ffb7236ca68da0f9fed0e1682053b393db3c724ff3c5a4e8c0793b34c" }`
+		w.Write([]byte(body))
+	})
+
+	mux.HandleFunc("/v1.9/build", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected build image not created")
+	})
+
+	b := Builder{}
+	b.Repo = &repo.Repo{}
+	b.Repo.Path = "git://github.com/drone/drone.git"
+	b.Build = &script.Build{}
+	b.Build.Image = "go1.2"
+	b.Key = []byte("ssh-rsa AAA...")
+	b.Mount = true
+	b.dockerClient = client
+
+	if err := b.setup(); err != nil {
+		t.Fatalf("Expected success, got %s", err)
+	}
+
+	if b.image != nil {
+		t.Errorf("Expected image nil, got %s", b.image.ID)
+	}
+
+	for _, name := range []string{"files/drone", "files/id_rsa", "files/changed_files", "files/entrypoint", "src"} {
+		if _, err := os.Stat(filepath.Join(b.mount, name)); err != nil {
+			t.Errorf("Expected %s written to the mounted directory", name)
+		}
+	}
+
+	// the files are only readable by the owner
+	for name, want := range map[string]os.FileMode{"files": 0700, "files/id_rsa": 0600, "src": 0700} {
+		info, err := os.Stat(filepath.Join(b.mount, name))
+		if err != nil {
+			continue
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("Expected %s mode %v, got %v", name, want, got)
+		}
+	}
+
+	// the key is installed by the entrypoint
+	entrypoint, _ := ioutil.ReadFile(filepath.Join(b.mount, "files", "entrypoint"))
+	if !strings.Contains(string(entrypoint), "cp /var/cache/drone.d/id_rsa /home/ubuntu/.ssh/id_rsa\n") {
+		t.Errorf("Expected entrypoint to install the key, got %s", entrypoint)
+	}
+
+	// the mounted directory is removed when the
+	// build is done.
+	b.teardown()
+	if _, err := os.Stat(b.mount); !os.IsNotExist(err) {
+		t.Errorf("Expected mounted directory removed")
+	}
+}
+
+// TestRunMount will test our ability to run the stock image
+// with the build files and source code mounted.
+func TestRunMount(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var conf = docker.Config{}
+	var host = docker.HostConfig{}
+
+	mux.HandleFunc("/v1.9/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&conf)
+		body := `{ "Id":"e90e34656806", "Warnings":[] }`
+		w.Write([]byte(body))
+	})
+
+	mux.HandleFunc("/v1.9/containers/e90e34656806/start", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&host)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	b := Builder{}
+	b.BuildState = &BuildState{}
+	b.dockerClient = client
+	b.Stdout = new(bytes.Buffer)
+	b.Build = &script.Build{Image: "busybox", User: "root", Home: "/root"}
+	b.Repo = &repo.Repo{Path: "/home/drone/src", Dir: "/var/cache/drone/src/drone"}
+	b.Mount = true
+	b.mount = "/tmp/drone/build-123"
+	b.run()
+
+	if conf.Image != "busybox" {
+		t.Errorf("Expected stock image busybox, got %s", conf.Image)
+	}
+	if conf.WorkingDir != b.Repo.Dir {
+		t.Errorf("Expected working directory %s, got %s", b.Repo.Dir, conf.WorkingDir)
+	}
+	if len(conf.Entrypoint) != 2 || conf.Entrypoint[1] != "/var/cache/drone.d/entrypoint" {
+		t.Errorf("Expected entrypoint to run the mounted entrypoint script, got %v", conf.Entrypoint)
+	}
+	if conf.User != "root" {
+		t.Errorf("Expected container started as root to install the build files, got %s", conf.User)
+	}
+
+	var want = []string{
+		"/tmp/drone/build-123/files:/var/cache/drone.d:ro",
+		"/home/drone/src:/var/cache/drone/src/drone",
+	}
+	if len(host.Binds) != len(want) {
+		t.Fatalf("Expected binds %v, got %v", want, host.Binds)
+	}
+	for i := range want {
+		if host.Binds[i] != want[i] {
+			t.Errorf("Expected bind %s, got %s", want[i], host.Binds[i])
+		}
+	}
+}
+
+// TestWriteEntrypoint will test our ability to write the
+// entrypoint script, which installs the mounted build files
+// and runs the build script as the build user.
+func TestWriteEntrypoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := Builder{}
+	b.Repo = &repo.Repo{
+		Path: "git://github.com/drone/drone.git",
+		Dir:  "/var/cache/drone/src/github.com/drone/drone"}
+	b.Build = &script.Build{User: "ubuntu", Home: "/home/ubuntu", Shell: "/bin/bash"}
+	if err := b.writeEntrypoint(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "entrypoint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []string{
+		"cp /var/cache/drone.d/drone /usr/local/bin/drone\n",
+		"cp /var/cache/drone.d/id_rsa /home/ubuntu/.ssh/id_rsa\n",
+		"chmod 600 /home/ubuntu/.ssh/id_rsa\n",
+		"chown ubuntu /var/cache/drone/src/github.com/drone/drone\n",
+		"chown -R ubuntu /home/ubuntu/.ssh /usr/local/bin/drone\n",
+		"exec su -m -s /bin/sh -c '/bin/bash -e /usr/local/bin/drone' ubuntu\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(string(got), w) {
+			t.Errorf("Expected entrypoint to contain %q, got %s", w, got)
+		}
+	}
+	if strings.Contains(string(got), "chown ubuntu /var/cache/drone/src/github.com/drone\n") {
+		t.Errorf("Expected the parent directory unchanged, got %s", got)
+	}
+
+	// the root user runs the build script directly
+	b.Build = &script.Build{User: "root", Home: "/root", Shell: "/bin/bash"}
+	if err := b.writeEntrypoint(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = ioutil.ReadFile(filepath.Join(dir, "entrypoint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "chown") || strings.Contains(string(got), "su ") {
+		t.Errorf("Expected no chown or su for the root user, got %s", got)
+	}
+	if !strings.Contains(string(got), "exec /bin/sh -c '/bin/bash -e /usr/local/bin/drone'\n") {
+		t.Errorf("Expected entrypoint to run the build script, got %s", got)
+	}
+}
+
 func TestRunErrorCreate(t *testing.T) {
 	setup()
 	defer teardown()
@@ -463,6 +882,74 @@ func TestRunErrorWait(t *testing.T) {
 	t.Skip()
 }
 
+// TestRunMergeConflict will test our ability to detect a Pull
+// Request that can't be merged, using the merge conflict file
+// instead of the exit code of the build.
+func TestRunMergeConflict(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var (
+		resource string
+		exists   bool
+	)
+
+	mux.HandleFunc("/v1.9/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		body := `{ "Id":"e90e34656806", "Warnings":[] }`
+		w.Write([]byte(body))
+	})
+
+	mux.HandleFunc("/v1.9/containers/e90e34656806/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/v1.9/containers/e90e34656806/wait", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "StatusCode":99 }`))
+	})
+
+	mux.HandleFunc("/v1.9/containers/e90e34656806/copy", func(w http.ResponseWriter, r *http.Request) {
+		conf := docker.CopyConfig{}
+		json.NewDecoder(r.Body).Decode(&conf)
+		resource = conf.Resource
+		if !exists {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	b := Builder{}
+	b.BuildState = &BuildState{}
+	b.dockerClient = client
+	b.Stdout = new(bytes.Buffer)
+	b.image = &docker.Image{ID: "c3ab8ff137"}
+	b.Build = &script.Build{}
+	b.Repo = &repo.Repo{
+		Dir:        "/var/cache/drone/src/github.com/drone/drone",
+		PR:         "5",
+		Merge:      true,
+		BaseBranch: "master",
+		BaseCommit: "3a8b3a4",
+	}
+
+	// the exit code alone doesn't indicate a conflict
+	if err := b.run(); err != nil {
+		t.Errorf("Expected build to run, got %s", err)
+	}
+	if b.BuildState.MergeConflict {
+		t.Errorf("Expected no merge conflict without the merge conflict file")
+	}
+	if want := "/var/cache/drone/src/github.com/drone/drone/.git/DRONE_MERGE_CONFLICT"; resource != want {
+		t.Errorf("Expected merge conflict file %s, got %s", want, resource)
+	}
+
+	exists = true
+	if err := b.run(); err != nil {
+		t.Errorf("Expected build to run, got %s", err)
+	}
+	if !b.BuildState.MergeConflict {
+		t.Errorf("Expected merge conflict when the merge conflict file exists")
+	}
+}
+
 func TestWriteIdentifyFile(t *testing.T) {
 	// temporary directory to store file
 	dir, _ := ioutil.TempDir("", "drone-test-")
@@ -483,39 +970,319 @@ func TestWriteIdentifyFile(t *testing.T) {
 	}
 }
 
-func TestWriteProxyScript(t *testing.T) {
+func TestWriteChangedFiles(t *testing.T) {
 	// temporary directory to store file
 	dir, _ := ioutil.TempDir("", "drone-test-")
 	defer os.RemoveAll(dir)
 
-	// fake service container that we'll assume was part of the yaml
-	// and should be attached to the build container.
-	c := docker.Container{
-		NetworkSettings: &docker.NetworkSettings{
-			IPAddress: "172.1.4.5",
-			Ports: map[docker.Port][]docker.PortBinding{
-				docker.NewPort("tcp", "3306"): nil,
-			},
-		},
+	b := Builder{}
+	b.Repo = &repo.Repo{Files: []string{"README.md", "pkg/build/build.go"}}
+	b.writeChangedFiles(dir)
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "changed_files"))
+	if err != nil {
+		t.Errorf("Expected changed_files file saved to disk")
+	}
+
+	want := "README.md\npkg/build/build.go\n"
+	if string(got) != want {
+		t.Errorf("Expected changed_files value saved as %s, got %s", want, got)
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	var tests = []struct {
+		image *docker.Image
+		build *script.Build
+		user  string
+		home  string
+		shell string
+	}{
+		// custom images without a user run as root, and the
+		// shell is detected when the container starts.
+		{&docker.Image{}, &script.Build{Image: "busybox"}, "root", "/root", ""},
+		// the official images run as the ubuntu user.
+		{&docker.Image{}, &script.Build{Image: "bradrydzewski/go:1.2"}, "ubuntu", "/home/ubuntu", "/bin/bash"},
+		// the user, home and shell are read from the image.
+		{&docker.Image{Config: &docker.Config{User: "app:staff", Env: []string{"HOME=/app", "SHELL=/bin/ash"}}},
+			&script.Build{Image: "alpine"}, "app:staff", "/app", "/bin/ash"},
+		{&docker.Image{Config: &docker.Config{User: "app"}},
+			&script.Build{Image: "alpine"}, "app", "/home/app", ""},
+		// the build configuration takes precedence.
+		{&docker.Image{Config: &docker.Config{User: "app", Env: []string{"HOME=/app"}}},
+			&script.Build{Image: "alpine", User: "root", Shell: "/bin/sh"}, "root", "/root", "/bin/sh"},
+		{&docker.Image{}, &script.Build{Image: "drone/go", User: "drone", Home: "/drone"}, "drone", "/drone", "/bin/bash"},
 	}
 
-	// this should generate the following proxy file
-	p := proxy.Proxy{}
-	p.Set("3306", "172.1.4.5")
-	want := p.String()
+	for _, test := range tests {
+		b := Builder{Build: test.build}
+		b.resolveUser(test.image)
+
+		if b.Build.User != test.user {
+			t.Errorf("Expected user %s for %s, got %s", test.user, test.build.Image, b.Build.User)
+		}
+		if b.Build.Home != test.home {
+			t.Errorf("Expected home %s for %s, got %s", test.home, test.build.Image, b.Build.Home)
+		}
+		if b.Build.Shell != test.shell {
+			t.Errorf("Expected shell %s for %s, got %s", test.shell, test.build.Image, b.Build.Shell)
+		}
+	}
+}
+
+func TestWriteDockerfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
 	b := Builder{}
-	b.services = append(b.services, &c)
-	b.writeProxyScript(dir)
+	b.Repo = &repo.Repo{
+		Path: "git://github.com/drone/drone.git",
+		Dir:  "/var/cache/drone/github.com/drone/drone"}
+	b.Build = &script.Build{Image: "busybox", User: "root", Home: "/root"}
+	b.writeDockerfile(dir)
 
-	// persist a dummy proxy script to disk
-	got, err := ioutil.ReadFile(filepath.Join(dir, "proxy.sh"))
+	got, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
 	if err != nil {
-		t.Errorf("Expected proxy.sh file saved to disk")
+		t.Fatal(err)
 	}
 
-	if string(got) != want {
-		t.Errorf("Expected proxy.sh value saved as %s, got %s", want, got)
+	// the shell is unknown, so the entrypoint should
+	// fall back to the POSIX shell.
+	if !strings.Contains(string(got), "ENTRYPOINT "+b.entrypoint("/usr/local/bin/drone")+"\n") {
+		t.Errorf("Expected entrypoint to detect the shell, got %s", got)
+	}
+	if strings.Contains(string(got), "chown") {
+		t.Errorf("Expected no chown for the root user, got %s", got)
+	}
+
+	b.Build = &script.Build{Image: "alpine", User: "app", Home: "/app", Shell: "/bin/ash"}
+	b.writeDockerfile(dir)
+
+	got, err = ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []string{
+		"ADD id_rsa /app/.ssh/id_rsa\n",
+		"RUN chown -R app /app/.ssh /usr/local/bin/drone\n",
+		"RUN mkdir -p /var/cache/drone/github.com/drone/drone\n",
+		"RUN chown -R app /var/cache/drone/github.com/drone/drone\n",
+		"USER app\n",
+		"ENV HOME /app\n",
+		"ENV SHELL /bin/ash\n",
+		"ENTRYPOINT /bin/ash -e /usr/local/bin/drone\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(string(got), w) {
+			t.Errorf("Expected Dockerfile to contain %q, got %s", w, got)
+		}
+	}
+	if strings.Contains(string(got), "sudo") {
+		t.Errorf("Expected Dockerfile without sudo, got %s", got)
+	}
+	if strings.Contains(string(got), "/var/cache/drone/github.com/drone ") {
+		t.Errorf("Expected the parent directory unchanged, got %s", got)
+	}
+
+	// system directories are never owned by the build user
+	b.Repo.Dir = "/usr"
+	b.writeDockerfile(dir)
+
+	got, err = ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "chown -R app /usr\n") {
+		t.Errorf("Expected system directory unchanged, got %s", got)
+	}
+}
+
+func TestUpdateMirror(t *testing.T) {
+	// temporary directory to store the repository and mirror
+	dir, _ := ioutil.TempDir("", "drone-test-")
+	defer os.RemoveAll(dir)
+
+	tmp := os.Getenv("DRONE_TMP")
+	os.Setenv("DRONE_TMP", filepath.Join(dir, "tmp"))
+	defer os.Setenv("DRONE_TMP", tmp)
+
+	src := filepath.Join(dir, "src")
+	commit := func() string {
+		git := func(args ...string) string {
+			args = append([]string{"-c", "user.name=drone", "-c", "user.email=drone@localhost"}, args...)
+			cmd := exec.Command("git", args...)
+			cmd.Dir = src
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v failed. %s", args, out)
+			}
+			return string(bytes.TrimSpace(out))
+		}
+		git("commit", "--allow-empty", "-q", "-m", "test")
+		return git("rev-parse", "HEAD")
+	}
+	os.MkdirAll(src, 0777)
+	exec.Command("git", "init", "-q", src).Run()
+
+	b := Builder{}
+	b.Repo = &repo.Repo{Name: "github.com/drone/drone", Path: src}
+
+	// the mirror is created if it does not exist, and
+	// updated with new commits when it does.
+	for i := 0; i < 2; i++ {
+		sha := commit()
+		path, err := b.updateMirror()
+		if err != nil {
+			t.Fatalf("Expected mirror updated, got %s", err)
+		}
+		if want := filepath.Join(dir, "tmp", "mirror", "github.com/drone/drone"); path != want {
+			t.Errorf("Expected mirror path %s, got %s", want, path)
+		}
+		if err := exec.Command("git", "--git-dir="+path, "cat-file", "-e", sha).Run(); err != nil {
+			t.Errorf("Expected mirror to include commit %s", sha)
+		}
+	}
+
+	// the mirror can't be updated if the repository
+	// does not exist.
+	b.Repo = &repo.Repo{Name: "github.com/drone/missing", Path: filepath.Join(dir, "missing")}
+	if _, err := b.updateMirror(); err == nil {
+		t.Errorf("Expected error updating mirror of missing repository")
+	}
+}
+
+func TestWriteServiceEnv(t *testing.T) {
+	// fake service containers that we'll assume were part of
+	// the yaml and should be attached to the build container.
+	b := Builder{}
+	b.services = []*docker.Container{
+		{NetworkSettings: &docker.NetworkSettings{IPAddress: "172.1.4.5"}},
+		{NetworkSettings: &docker.NetworkSettings{IPAddress: "172.1.4.6"}},
+	}
+	b.serviceConfs = []*script.Service{
+		{Image: "bradrydzewski/mysql:5.5", Alias: "mysql", Ports: []string{"3306"}},
+		{Image: "acme/api", Alias: "my-api", Ports: []string{"80", "443"}},
+	}
+
+	want := buildfile.New()
+	want.WriteEnv("DRONE_SERVICE_MYSQL_HOST", "172.1.4.5")
+	want.WriteEnv("DRONE_SERVICE_MYSQL_PORT", "3306")
+	want.WriteEnv("DRONE_SERVICE_MY_API_HOST", "172.1.4.6")
+	want.WriteEnv("DRONE_SERVICE_MY_API_PORT", "80")
+
+	got := buildfile.New()
+	b.writeServiceEnv(got)
+	if got.String() != want.String() {
+		t.Errorf("Expected service env %s, got %s", want.String(), got.String())
+	}
+
+	// services are reached on localhost when the
+	// network namespace is shared.
+	b.shared = true
+	got = buildfile.New()
+	b.writeServiceEnv(got)
+	if !strings.Contains(got.String(), "export DRONE_SERVICE_MYSQL_HOST=127.0.0.1\n") {
+		t.Errorf("Expected service reached on localhost, got %s", got.String())
+	}
+}
+
+func TestResolveHosts(t *testing.T) {
+	b := Builder{}
+	b.Build = &script.Build{
+		Hosts: []string{"10.0.0.5 db db.local", "invalid"}}
+	services := []*script.Service{{Alias: "mysql"}, {Alias: "redis"}}
+
+	got := strings.Join(b.resolveHosts(services), ",")
+	if want := "db:10.0.0.5,db.local:10.0.0.5"; got != want {
+		t.Errorf("Expected hosts %s, got %s", want, got)
+	}
+
+	// services are mapped to localhost when the
+	// network namespace is shared.
+	b.shared = true
+	got = strings.Join(b.resolveHosts(services), ",")
+	if want := "db:10.0.0.5,db.local:10.0.0.5,mysql:127.0.0.1,redis:127.0.0.1"; got != want {
+		t.Errorf("Expected hosts %s, got %s", want, got)
+	}
+}
+
+// TestRunExtraHosts will test that the /etc/hosts entries
+// are added by Docker when the build container starts.
+func TestRunExtraHosts(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var host docker.HostConfig
+
+	mux.HandleFunc("/v1.9/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		body := `{ "Id":"e90e34656806", "Warnings":[] }`
+		w.Write([]byte(body))
+	})
+
+	mux.HandleFunc("/v1.9/containers/e90e34656806/start", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&host)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	b := Builder{}
+	b.BuildState = &BuildState{}
+	b.dockerClient = client
+	b.Stdout = new(bytes.Buffer)
+	b.image = &docker.Image{ID: "c3ab8ff137"}
+	b.Build = &script.Build{}
+	b.Repo = &repo.Repo{}
+	b.hosts = []string{"db:10.0.0.5"}
+	b.run()
+
+	if len(host.ExtraHosts) != 1 || host.ExtraHosts[0] != "db:10.0.0.5" {
+		t.Errorf("Expected extra hosts [db:10.0.0.5], got %v", host.ExtraHosts)
+	}
+
+	// the hosts are added to the service container
+	// when the network namespace is shared.
+	b.shared = true
+	b.services = []*docker.Container{{ID: "a1b2c3d4"}}
+	b.serviceConfs = []*script.Service{{Alias: "mysql"}}
+	host = docker.HostConfig{}
+	b.run()
+
+	if len(host.ExtraHosts) != 0 {
+		t.Errorf("Expected no extra hosts in the shared network, got %v", host.ExtraHosts)
+	}
+	if host.NetworkMode != "container:a1b2c3d4" {
+		t.Errorf("Expected network of the service container, got %s", host.NetworkMode)
+	}
+}
+
+func TestCanShareNetwork(t *testing.T) {
+	var buf bytes.Buffer
+	b := Builder{Stdout: &buf}
+	b.Build = &script.Build{Network: script.NetworkShared}
+
+	mysql := &script.Service{Alias: "mysql", Ports: []string{"3306"}}
+	redis := &script.Service{Alias: "redis", Ports: []string{"6379"}}
+	if !b.canShareNetwork([]*script.Service{mysql, redis}) {
+		t.Errorf("Expected services can share the network")
+	}
+
+	// services that listen on the same port can't
+	// share the network, and a warning is written.
+	mariadb := &script.Service{Alias: "mariadb", Ports: []string{"3306"}}
+	if b.canShareNetwork([]*script.Service{mysql, mariadb}) {
+		t.Errorf("Expected services listening on the same port can't share the network")
+	}
+	if !strings.Contains(buf.String(), "WARNING: unable to share the network") {
+		t.Errorf("Expected warning in build output, got %s", buf.String())
+	}
+
+	// the network is not shared unless requested
+	b.Build.Network = ""
+	if b.canShareNetwork([]*script.Service{mysql, redis}) {
+		t.Errorf("Expected network not shared unless requested")
 	}
 }
 
@@ -546,9 +1313,11 @@ func TestWriteBuildScript(t *testing.T) {
 	f.WriteEnv("DRONE", "true")
 	f.WriteEnv("DRONE_BRANCH", "master")
 	f.WriteEnv("DRONE_COMMIT", "e7e046b35")
+	f.WriteEnv("DRONE_TAG", "")
 	f.WriteEnv("DRONE_PR", "123")
+	f.WriteEnv("DRONE_PR_BASE", "")
 	f.WriteEnv("DRONE_BUILD_DIR", "/var/cache/drone/github.com/drone/drone")
-	f.WriteHost("127.0.0.1")
+	f.WriteEnv("DRONE_CHANGED_FILES", "/etc/drone.d/changed_files")
 	f.WriteCmd("git clone --depth=0 --recursive --branch=master git://github.com/drone/drone.git /var/cache/drone/github.com/drone/drone")
 	f.WriteCmd("git fetch origin +refs/pull/123/head:refs/remotes/origin/pr/123")
 	f.WriteCmd("git checkout -qf -b pr/123 origin/pr/123")
@@ -557,3 +1326,89 @@ func TestWriteBuildScript(t *testing.T) {
 		t.Errorf("Expected build script value saved as %s, got %s", f.String(), script)
 	}
 }
+
+// TestWriteBuildScriptTag will test the ability to write a
+// build script for a tag, including deployments that are
+// limited to tags.
+func TestWriteBuildScriptTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := Builder{}
+	b.Build = &script.Build{
+		Deploy: &deploy.Deploy{
+			Heroku: &deploy.Heroku{App: "drone"},
+			Tag:    true}}
+	b.Repo = &repo.Repo{
+		Path:   "git://github.com/drone/drone.git",
+		Branch: "v0.1",
+		Commit: "e7e046b35",
+		Tag:    "v0.1",
+		Dir:    "/var/cache/drone/github.com/drone/drone"}
+	b.writeBuildScript(dir)
+
+	script, err := ioutil.ReadFile(filepath.Join(dir, "drone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(script), "export DRONE_TAG=v0.1\n") {
+		t.Errorf("Expected DRONE_TAG environment variable in build script, got %s", script)
+	}
+	if !strings.Contains(string(script), "--branch=v0.1") {
+		t.Errorf("Expected tag v0.1 to be cloned, got %s", script)
+	}
+	if !strings.Contains(string(script), "git push heroku") {
+		t.Errorf("Expected heroku deployment for a tag, got %s", script)
+	}
+
+	// the deployment is omitted when the build
+	// is not for a tag.
+	b.Repo.Tag = ""
+	b.writeBuildScript(dir)
+
+	script, err = ioutil.ReadFile(filepath.Join(dir, "drone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(script), "git push heroku") {
+		t.Errorf("Expected heroku deployment omitted for a branch, got %s", script)
+	}
+}
+
+// TestWriteBuildScriptWorkdir will test the ability to write a
+// build script that runs the build commands in a subdirectory
+// of the repository.
+func TestWriteBuildScriptWorkdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := Builder{}
+	b.Build = &script.Build{
+		Workdir: "src/app",
+		Script:  []string{"make"}}
+	b.Repo = &repo.Repo{
+		Path:   "git://github.com/drone/drone.git",
+		Branch: "master",
+		Dir:    "/var/cache/drone/github.com/drone/drone"}
+	b.writeBuildScript(dir)
+
+	script, err := ioutil.ReadFile(filepath.Join(dir, "drone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "cd /var/cache/drone/github.com/drone/drone/src/app\n"
+	if !strings.Contains(string(script), want) {
+		t.Errorf("Expected build script to change to the working directory, got %s", script)
+	}
+	if strings.Index(string(script), want) > strings.Index(string(script), "\nmake\n") {
+		t.Errorf("Expected working directory to be changed before the build commands, got %s", script)
+	}
+}
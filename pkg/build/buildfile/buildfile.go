@@ -55,7 +55,7 @@ func (b *Buildfile) WriteHost(mapping string) {
 // every build script starts with the following
 // code at the start.
 var base = `
-#!/bin/bash
+#!/bin/sh
 
 # drone configuration files are stored in /etc/drone.d
 # execute these files prior to our build to set global
@@ -70,7 +70,7 @@ if [ -d /etc/drone.d ]; then
 fi
 
 # be sure to exit on error and print out
-# our bash commands, so we can which commands
+# our commands, so we can which commands
 # are executing and troubleshoot failures.
 set -e
 
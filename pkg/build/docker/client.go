@@ -67,6 +67,10 @@ var (
 	// Returned if the caller submits a badly formed request. For example,
 	// the caller can receive this return if you forget a required parameter.
 	ErrBadRequest = errors.New("Bad Request")
+
+	// Returned if the Docker daemon fails to process the request. For
+	// example, when copying a file that doesn't exist in the container.
+	ErrInternalServer = errors.New("Internal Server Error")
 )
 
 func (c *Client) setHost(defaultUnixSocket string) {
@@ -218,7 +222,9 @@ func (c *Client) stream(method, path string, in io.Reader, out io.Writer, header
 	// set default headers
 	req.Header = headers
 	req.Header.Set("User-Agent", "Docker-Client/0.6.4")
-	req.Header.Set("Content-Type", "plain/text")
+	if len(req.Header.Get("Content-Type")) == 0 {
+		req.Header.Set("Content-Type", "plain/text")
+	}
 
 	// dial the host server
 	req.Host = c.addr
@@ -248,6 +254,8 @@ func (c *Client) stream(method, path string, in io.Reader, out io.Writer, header
 		return ErrNotAuthorized
 	case 400:
 		return ErrBadRequest
+	case 500:
+		return ErrInternalServer
 	}
 
 	// If no output we exit now with no errors
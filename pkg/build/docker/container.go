@@ -1,8 +1,12 @@
 package docker
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"time"
 )
 
 type ContainerService struct {
@@ -81,6 +85,18 @@ func (c *ContainerService) Attach(id string, out io.Writer) error {
 	return c.hijack("POST", path, false, out)
 }
 
+// Copy writes the file or directory at path inside the
+// container id to the writer, as a tar archive.
+func (c *ContainerService) Copy(id, path string, out io.Writer) error {
+	in, err := json.Marshal(&CopyConfig{Resource: path})
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	return c.stream("POST", fmt.Sprintf("/containers/%s/copy", id), bytes.NewReader(in), out, headers)
+}
+
 // Stop the container id
 func (c *ContainerService) Inspect(id string) (*Container, error) {
 	container := Container{}
@@ -88,6 +104,36 @@ func (c *ContainerService) Inspect(id string) (*Container, error) {
 	return &container, err
 }
 
+// Exec runs the command inside the running container id,
+// and blocks until the command exits. It returns the exit
+// code of the command. This requires Docker 1.3 or higher.
+func (c *ContainerService) Exec(id string, cmd []string) (int, error) {
+	// create the command
+	run := Run{}
+	conf := ExecConfig{Cmd: cmd}
+	if err := c.do("POST", fmt.Sprintf("/containers/%s/exec", id), &conf, &run); err != nil {
+		return 0, err
+	}
+
+	// start the command in the background
+	start := ExecConfig{Detach: true}
+	if err := c.do("POST", fmt.Sprintf("/exec/%s/start", run.ID), &start, nil); err != nil {
+		return 0, err
+	}
+
+	// wait for the command to exit
+	for {
+		exec := Exec{}
+		if err := c.do("GET", fmt.Sprintf("/exec/%s/json", run.ID), nil, &exec); err != nil {
+			return 0, err
+		}
+		if !exec.Running {
+			return exec.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // Run the container
 func (c *ContainerService) Run(conf *Config, host *HostConfig, out io.Writer) (*Wait, error) {
 	// create the container from the image
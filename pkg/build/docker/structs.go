@@ -24,6 +24,8 @@ type HostConfig struct {
 	PortBindings    map[Port][]PortBinding
 	Links           []string
 	PublishAllPorts bool
+	NetworkMode     string
+	ExtraHosts      []string
 }
 
 type Top struct {
@@ -52,6 +54,25 @@ type Wait struct {
 	StatusCode int
 }
 
+type ExecConfig struct {
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	Tty          bool
+	Detach       bool
+	Cmd          []string
+}
+
+type Exec struct {
+	ID       string
+	Running  bool
+	ExitCode int
+}
+
+type CopyConfig struct {
+	Resource string
+}
+
 type State struct {
 	Running    bool
 	Pid        int
@@ -1,7 +1,15 @@
 package git
 
+import (
+	"path/filepath"
+)
+
 const (
 	DefaultGitDepth = 50
+
+	// DefaultGitRoot is the directory, inside the
+	// container, where repositories are cloned.
+	DefaultGitRoot = "/var/cache/drone/src"
 )
 
 // Git stores the configuration details for
@@ -12,11 +20,24 @@ type Git struct {
 	// number of revisions.
 	Depth *int `yaml:"depth,omitempty"`
 
-	// The name of a directory to clone into.
-	// TODO this still needs to be implemented. this field is
-	//      critical for forked Go projects, that need to clone
-	//      to a specific repository.
+	// The name of a directory to clone into. This is
+	// critical for forked Go projects, that need to clone
+	// to a specific repository. A relative path is cloned
+	// into the DefaultGitRoot directory.
 	Path string `yaml:"path,omitempty"`
+
+	// Submodules instructs git to recursively clone
+	// the repository's submodules. Defaults to true.
+	Submodules *bool `yaml:"submodules,omitempty"`
+
+	// Tags instructs git to fetch all tags after
+	// the repository is cloned.
+	Tags bool `yaml:"tags,omitempty"`
+
+	// Merge instructs git to merge a pull request into
+	// the base branch, so that the result of the merge
+	// is tested instead of the pull request in isolation.
+	Merge bool `yaml:"merge,omitempty"`
 }
 
 // GitDepth returns GitDefaultDepth
@@ -29,3 +50,39 @@ func GitDepth(g *Git) int {
 	}
 	return *g.Depth
 }
+
+// GitPath returns the absolute path of the directory
+// that the repository is cloned into. The repository
+// name is used when Git.Path is empty.
+func GitPath(g *Git, name string) string {
+	if g != nil && len(g.Path) != 0 {
+		name = g.Path
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(DefaultGitRoot, filepath.Clean("/"+name))
+}
+
+// GitSubmodules returns true
+// when Git.Submodules is empty.
+// GitSubmodules returns Git.Submodules
+// when it is not empty.
+func GitSubmodules(g *Git) bool {
+	if g == nil || g.Submodules == nil {
+		return true
+	}
+	return *g.Submodules
+}
+
+// GitTags returns Git.Tags, or false
+// when Git is empty.
+func GitTags(g *Git) bool {
+	return g != nil && g.Tags
+}
+
+// GitMerge returns Git.Merge, or false
+// when Git is empty.
+func GitMerge(g *Git) bool {
+	return g != nil && g.Merge
+}
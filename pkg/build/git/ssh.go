@@ -0,0 +1,30 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// sshWrapper is a script used as the GIT_SSH command, so
+// that the private key is used to authenticate.
+const sshWrapper = `#!/bin/sh
+exec ssh -i %s -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o BatchMode=yes "$@"
+`
+
+// WriteSSH writes the private key and a wrapper for the
+// ssh command, which authenticates using the key, to the
+// directory. It returns the path of the wrapper, which can
+// be used as the GIT_SSH command on the host machine.
+func WriteSSH(dir string, key []byte) (string, error) {
+	keyfile := filepath.Join(dir, "id_rsa")
+	if err := ioutil.WriteFile(keyfile, key, 0600); err != nil {
+		return "", err
+	}
+
+	ssh := filepath.Join(dir, "ssh")
+	if err := ioutil.WriteFile(ssh, []byte(fmt.Sprintf(sshWrapper, keyfile)), 0700); err != nil {
+		return "", err
+	}
+	return ssh, nil
+}
@@ -1,5 +1,11 @@
 package build
 
+import (
+	"strings"
+
+	"github.com/drone/drone/pkg/build/script"
+)
+
 type image struct {
 	// default ports the service will run on.
 	// for example, 3306 for mysql. Note that a service
@@ -170,6 +176,37 @@ var services = map[string]*image{
 	},
 }
 
+// resolveService returns the configuration of the service,
+// using the image, ports and alias of the preset service if
+// the image is the name of a preset. The alias is derived
+// from the image name, unless one is provided.
+func resolveService(s *script.Service) *script.Service {
+	service := *s
+	if preset, ok := services[s.Image]; ok {
+		service.Image = preset.Tag
+		if len(service.Ports) == 0 {
+			service.Ports = preset.Ports
+		}
+		if len(service.Alias) == 0 {
+			service.Alias = preset.Name
+		}
+	}
+
+	// the alias defaults to the name of the image,
+	// without the registry, namespace and tag.
+	if len(service.Alias) == 0 {
+		alias := service.Image
+		if i := strings.LastIndex(alias, "/"); i != -1 {
+			alias = alias[i+1:]
+		}
+		if i := strings.Index(alias, ":"); i != -1 {
+			alias = alias[:i]
+		}
+		service.Alias = alias
+	}
+	return &service
+}
+
 // List of official Drone build images.
 var builders = map[string]*image{
 
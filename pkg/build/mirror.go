@@ -0,0 +1,109 @@
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/drone/drone/pkg/build/git"
+	"github.com/drone/drone/pkg/build/log"
+)
+
+// mirrorDir is the path where the bare mirror of the
+// repository is mounted inside the build container.
+const mirrorDir = "/var/cache/drone/mirror"
+
+// mirrorLocks serializes updates to the same mirror,
+// since builds for the same repository may run at
+// the same time.
+var mirrorLocks = struct {
+	sync.Mutex
+	paths map[string]*sync.Mutex
+}{paths: map[string]*sync.Mutex{}}
+
+// mirrorLock returns the lock for the mirror
+// at the given path.
+func mirrorLock(path string) *sync.Mutex {
+	mirrorLocks.Lock()
+	defer mirrorLocks.Unlock()
+
+	lock, ok := mirrorLocks.paths[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		mirrorLocks.paths[path] = lock
+	}
+	return lock
+}
+
+// hasGit returns true if git is installed on the
+// host machine, which is required to keep a mirror.
+func hasGit() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// tempPath returns the directory on the host machine
+// where cached volumes and mirrors are stored.
+func tempPath() string {
+	if len(os.Getenv("DRONE_TMP")) > 0 {
+		return os.Getenv("DRONE_TMP")
+	}
+	return "/tmp/drone"
+}
+
+// updateMirror is a helper function that will create or
+// update a bare mirror of the repository on the host
+// machine, and returns the path of the mirror. The mirror
+// is updated using the repository key, if provided.
+func (b *Builder) updateMirror() (string, error) {
+	hostpath := filepath.Join(tempPath(), "mirror", filepath.Clean("/"+b.Repo.Name))
+
+	lock := mirrorLock(hostpath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// temp directory to store the key and ssh wrapper
+	dir, err := ioutil.TempDir("", "drone-mirror-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	env := os.Environ()
+	if len(b.Key) != 0 {
+		ssh, err := git.WriteSSH(dir, b.Key)
+		if err != nil {
+			return "", err
+		}
+		env = append(env, "GIT_SSH="+ssh)
+	}
+
+	// if the mirror does not exist, or a previous clone
+	// did not complete, then we create a new mirror.
+	var cmd *exec.Cmd
+	if _, err := os.Stat(filepath.Join(hostpath, "HEAD")); err != nil {
+		log.Infof("creating mirror %s", hostpath)
+
+		os.RemoveAll(hostpath)
+		if err := os.MkdirAll(filepath.Dir(hostpath), 0777); err != nil {
+			return "", err
+		}
+		cmd = exec.Command("git", "clone", "--mirror", "--quiet", "--", b.Repo.Path, hostpath)
+	} else {
+		log.Infof("updating mirror %s", hostpath)
+
+		// objects are never garbage collected, since the
+		// mirror may be in use by a running build.
+		cmd = exec.Command("git", "-c", "gc.auto=0", "--git-dir="+hostpath, "fetch", "--quiet", "--prune", "origin")
+	}
+
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("Failed to update mirror %s: %s", hostpath, out)
+	}
+
+	return hostpath, nil
+}
@@ -0,0 +1,143 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone/pkg/build/docker"
+	"github.com/drone/drone/pkg/build/log"
+)
+
+// mountDir is the path where the build script, key and
+// changed files are mounted inside the build container,
+// when the build image isn't created. The files are
+// installed by the entrypoint script.
+const mountDir = "/var/cache/drone.d"
+
+// writeMountDir is a helper function that writes the build
+// script, key and changed files to a directory on the host
+// machine, so that they can be mounted in the build
+// container instead of being added to a build image.
+func (b *Builder) writeMountDir() error {
+	// the directory is created in the temp path, along
+	// with the cached volumes, so that it can be mounted
+	// by the Docker daemon.
+	if err := os.MkdirAll(tempPath(), 0777); err != nil {
+		return fmt.Errorf("Failed to create temp directory at %s: %s", tempPath(), err)
+	}
+	dir, err := ioutil.TempDir(tempPath(), "build-")
+	if err != nil {
+		return err
+	}
+	b.mount = dir
+
+	// the files are only readable by the root user of
+	// the build container, which installs them with the
+	// right ownership before the build script is run.
+	files := filepath.Join(dir, "files")
+	if err := os.Mkdir(files, 0700); err != nil {
+		return err
+	}
+
+	if err := b.writeIdentifyFile(files); err != nil {
+		return err
+	}
+
+	if err := b.writeBuildScript(files); err != nil {
+		return err
+	}
+
+	if err := b.writeChangedFiles(files); err != nil {
+		return err
+	}
+
+	if err := b.writeEntrypoint(files); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"id_rsa", "drone", "changed_files", "entrypoint"} {
+		if err := os.Chmod(filepath.Join(files, name), 0600); err != nil {
+			return err
+		}
+	}
+
+	// the repository is cloned into an empty directory,
+	// which is owned by the build user once the build
+	// container starts.
+	if b.Repo.IsRemote() {
+		return os.Mkdir(filepath.Join(dir, "src"), 0700)
+	}
+
+	return nil
+}
+
+// mountBuildDir is a helper function that mounts the build
+// files and the source code in the build container.
+func (b *Builder) mountBuildDir(conf *docker.Config, host *docker.HostConfig) error {
+	files := filepath.Join(b.mount, "files")
+	host.Binds = append(host.Binds, files+":"+mountDir+":ro")
+	conf.Volumes[mountDir] = struct{}{}
+
+	// debugging
+	log.Infof("mounting build files %s:%s", files, mountDir)
+
+	// local repositories are mounted directly, instead of
+	// being copied into the build image.
+	src := filepath.Join(b.mount, "src")
+	if b.Repo.IsLocal() {
+		path, err := filepath.Abs(b.Repo.Path)
+		if err != nil {
+			return err
+		}
+		src = path
+	}
+	host.Binds = append(host.Binds, src+":"+b.Repo.Dir)
+	conf.Volumes[b.Repo.Dir] = struct{}{}
+
+	// debugging
+	log.Infof("mounting source %s:%s", src, b.Repo.Dir)
+
+	return nil
+}
+
+// writeEntrypoint is a helper function that writes the
+// script executed by the root user when the build container
+// starts. It installs the build files, as the Dockerfile
+// does for a build image, and runs the build script as the
+// build user.
+func (b *Builder) writeEntrypoint(dir string) error {
+	var user, home = userName(b.Build.User), b.Build.Home
+
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/sh\n")
+	buf.WriteString("set -e\n")
+	fmt.Fprintf(&buf, "mkdir -p /etc/drone.d %s/.ssh\n", home)
+	fmt.Fprintf(&buf, "cp %s/drone /usr/local/bin/drone\n", mountDir)
+	fmt.Fprintf(&buf, "cp %s/changed_files /etc/drone.d/changed_files\n", mountDir)
+	fmt.Fprintf(&buf, "cp %s/id_rsa %s/.ssh/id_rsa\n", mountDir, home)
+	fmt.Fprintf(&buf, "chmod 600 %s/.ssh/id_rsa\n", home)
+	fmt.Fprintf(&buf, "echo 'StrictHostKeyChecking no' > %s/.ssh/config\n", home)
+
+	if isRoot(user) {
+		fmt.Fprintf(&buf, "exec /bin/sh -c '%s'\n", b.entrypoint("/usr/local/bin/drone"))
+		return ioutil.WriteFile(filepath.Join(dir, "entrypoint"), buf.Bytes(), 0600)
+	}
+
+	// the repository is cloned by the build user, which
+	// must own the directory the repository is cloned into.
+	// a local repository is mounted from the host machine,
+	// and its ownership is left unchanged, as are system
+	// directories.
+	fmt.Fprintf(&buf, "chown -R %s %s/.ssh /usr/local/bin/drone\n", b.Build.User, home)
+	if b.Repo.IsRemote() && !isSystemDir(b.Repo.Dir) {
+		fmt.Fprintf(&buf, "chown %s %s\n", b.Build.User, b.Repo.Dir)
+	}
+
+	// the environment of the container is preserved
+	// when switching to the build user.
+	fmt.Fprintf(&buf, "exec su -m -s /bin/sh -c '%s' %s\n", b.entrypoint("/usr/local/bin/drone"), user)
+	return ioutil.WriteFile(filepath.Join(dir, "entrypoint"), buf.Bytes(), 0600)
+}
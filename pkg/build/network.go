@@ -0,0 +1,96 @@
+package build
+
+import (
+	"strings"
+
+	"github.com/drone/drone/pkg/build/buildfile"
+	"github.com/drone/drone/pkg/build/script"
+)
+
+// canShareNetwork is a helper function that returns true
+// if the build and service containers can share a network
+// namespace. A warning is written to the build output if a
+// shared network is requested, but can't be provided.
+func (b *Builder) canShareNetwork(services []*script.Service) bool {
+	if b.Build.Network != script.NetworkShared || len(services) == 0 {
+		return false
+	}
+
+	// services that listen on the same port can't
+	// share a network namespace.
+	ports := map[string]string{}
+	for _, service := range services {
+		for _, port := range service.Ports {
+			if other, ok := ports[port]; ok {
+				b.printf("WARNING: unable to share the network with services %s and %s, which both listen on port %s. Services are not reachable on localhost, use their hostnames instead.\n", other, service.Alias, port)
+				return false
+			}
+			ports[port] = service.Alias
+		}
+	}
+	return true
+}
+
+// resolveHosts is a helper function that returns the
+// /etc/hosts entries of the build, in the hostname:ip
+// format used by Docker. Services are reached using the
+// alias of their link, unless the network namespace is
+// shared, in which case the aliases map to localhost.
+func (b *Builder) resolveHosts(services []*script.Service) []string {
+	var hosts []string
+	for _, mapping := range b.Build.Hosts {
+		fields := strings.Fields(mapping)
+		if len(fields) < 2 {
+			b.printf("WARNING: ignoring invalid host %q, expected an IP address followed by hostnames.\n", mapping)
+			continue
+		}
+		for _, name := range fields[1:] {
+			hosts = append(hosts, name+":"+fields[0])
+		}
+	}
+	if b.shared {
+		for _, service := range services {
+			hosts = append(hosts, service.Alias+":127.0.0.1")
+		}
+	}
+	return hosts
+}
+
+// writeServiceEnv is a helper function that adds the
+// environment variables for each service to the build
+// script, so that the services can be reached without
+// any tools in the build image.
+func (b *Builder) writeServiceEnv(f *buildfile.Buildfile) {
+	for i, container := range b.services {
+		service := b.serviceConfs[i]
+
+		// services are reached on localhost when
+		// the network namespace is shared.
+		ip := container.NetworkSettings.IPAddress
+		if b.shared {
+			ip = "127.0.0.1"
+		}
+
+		name := serviceEnvName(service.Alias)
+		f.WriteEnv(name+"_HOST", ip)
+		if len(service.Ports) != 0 {
+			f.WriteEnv(name+"_PORT", service.Ports[0])
+		}
+	}
+}
+
+// serviceEnvName returns the prefix of the environment
+// variables for the service alias, for example the alias
+// "my-db" is DRONE_SERVICE_MY_DB.
+func serviceEnvName(alias string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, alias)
+	return "DRONE_SERVICE_" + name
+}
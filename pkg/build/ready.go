@@ -0,0 +1,133 @@
+package build
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/drone/drone/pkg/build/docker"
+	"github.com/drone/drone/pkg/build/script"
+)
+
+// defaultReadyTimeout is the time we'll wait for a
+// service to become ready, unless a timeout is provided.
+const defaultReadyTimeout = 60 * time.Second
+
+// readyInterval is the time between readiness checks,
+// and the time limit of a single check.
+var readyInterval = time.Second
+
+// readyProgress is the time between progress messages
+// written to the build output while waiting.
+var readyProgress = 10 * time.Second
+
+// waitServices is a helper function that blocks until
+// all service containers are ready.
+func (b *Builder) waitServices() error {
+	for i, container := range b.services {
+		if err := b.waitService(b.serviceConfs[i], container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitService is a helper function that blocks until the
+// service container is ready, or the timeout expires. The
+// progress is written to the build output, so that users
+// know why the build hasn't started.
+func (b *Builder) waitService(service *script.Service, container *docker.Container) error {
+	timeout := defaultReadyTimeout
+	if service.Ready != nil && service.Ready.Timeout > 0 {
+		timeout = time.Duration(service.Ready.Timeout) * time.Second
+	}
+
+	b.printf("waiting for service %s to become ready\n", service.Alias)
+
+	start := time.Now()
+	progress := start
+	for {
+		err := b.checkService(service, container)
+		if err == nil {
+			b.printf("service %s is ready\n", service.Alias)
+			return nil
+		}
+
+		if time.Since(start) >= timeout {
+			err = fmt.Errorf("Error: service %s never became ready after %s. %s", service.Alias, timeout, err)
+			b.printf("%s\n", err)
+			return err
+		}
+
+		if time.Since(progress) >= readyProgress {
+			progress = time.Now()
+			b.printf("still waiting for service %s. %s\n", service.Alias, err)
+		}
+
+		// stop waiting if the build is killed.
+		select {
+		case <-b.Cancel:
+			return fmt.Errorf("Error: build killed while waiting for service %s", service.Alias)
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// checkService is a helper function that returns nil if
+// the service container is ready. A command is run inside
+// the container, or else an HTTP request or TCP connection
+// is made to the first port of the service.
+func (b *Builder) checkService(service *script.Service, container *docker.Container) error {
+	ready := service.Ready
+	if ready == nil {
+		ready = &script.Ready{}
+	}
+
+	if len(ready.Command) != 0 {
+		code, err := b.dockerClient.Containers.Exec(container.ID, ready.Command)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("Command exited with status %d", code)
+		}
+		return nil
+	}
+
+	// a service that doesn't expose any ports
+	// can't be checked.
+	if len(service.Ports) == 0 {
+		return nil
+	}
+
+	addr := net.JoinHostPort(container.NetworkSettings.IPAddress, service.Ports[0])
+
+	if len(ready.HTTP) != 0 {
+		client := http.Client{Timeout: readyInterval}
+		resp, err := client.Get("http://" + addr + ready.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("Request to %s returned status %d", ready.HTTP, resp.StatusCode)
+		}
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, readyInterval)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// printf is a helper function that writes a message
+// to the build output.
+func (b *Builder) printf(format string, a ...interface{}) {
+	if b.Stdout != nil {
+		fmt.Fprintf(b.Stdout, format, a...)
+	}
+}
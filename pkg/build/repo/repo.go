@@ -5,6 +5,18 @@ import (
 	"strings"
 )
 
+// MergeConflictFile is the file, relative to the repository
+// directory, that is created when a Pull Request can't be
+// merged into the base branch.
+const MergeConflictFile = ".git/DRONE_MERGE_CONFLICT"
+
+// Supported source control systems.
+const (
+	ScmGit = "git"
+	ScmHg  = "hg"
+	ScmSvn = "svn"
+)
+
 type Repo struct {
 	// The name of the Repository. This should be the
 	// canonical name, for example, github.com/drone/drone.
@@ -29,10 +41,28 @@ type Repo struct {
 	// value is provided we'll assume HEAD.
 	Commit string
 
+	// (optional) Tag that is being built. The Tag is
+	// cloned in place of the Branch.
+	Tag string
+
+	// (optional) Files changed by the Commit, relative
+	// to the root of the Repository.
+	Files []string
+
 	// (optional) Pull Request number that we should
 	// checkout when the Repository is cloned.
 	PR string
 
+	// (optional) Base Branch and Commit Hash of the
+	// Pull Request.
+	BaseBranch string
+	BaseCommit string
+
+	// (optional) Merge the Pull Request into the base
+	// commit when the Repository is cloned, instead of
+	// checking out the Pull Request.
+	Merge bool
+
 	// (optional) The filesystem path that the repository
 	// will be cloned into (or copied to) inside the
 	// host system (Docker Container).
@@ -40,6 +70,26 @@ type Repo struct {
 
 	// (optional) The depth of the `git clone` command.
 	Depth int
+
+	// (optional) Do not clone the submodules of a Git
+	// repository. By default submodules are cloned
+	// recursively.
+	NoSubmodules bool
+
+	// (optional) Fetch all tags of a Git repository
+	// after it is cloned.
+	Tags bool
+
+	// (optional) The path of a bare mirror of a Git
+	// repository inside the host system (Docker Container).
+	// The mirror is used as a reference when cloning, and
+	// we'll clone without it if the mirror is broken.
+	Mirror string
+
+	// (optional) The source control system of the
+	// Repository, either git, hg or svn. If no value
+	// is provided we'll assume git.
+	Scm string
 }
 
 // IsRemote returns true if the Repository is located
@@ -56,6 +106,10 @@ func (r *Repo) IsRemote() bool {
 		return true
 	case strings.HasPrefix(r.Path, "ssh://"):
 		return true
+	case strings.HasPrefix(r.Path, "svn://"):
+		return true
+	case strings.HasPrefix(r.Path, "svn+ssh://"):
+		return true
 	}
 
 	return false
@@ -70,6 +124,10 @@ func (r *Repo) IsLocal() bool {
 // IsGit returns true if the Repository is
 // a Git repoisitory.
 func (r *Repo) IsGit() bool {
+	if len(r.Scm) != 0 {
+		return r.Scm == ScmGit
+	}
+
 	switch {
 	case strings.HasPrefix(r.Path, "git://"):
 		return true
@@ -90,11 +148,65 @@ func (r *Repo) IsGit() bool {
 	return false
 }
 
+// IsHg returns true if the Repository is
+// a Mercurial repository.
+func (r *Repo) IsHg() bool {
+	if len(r.Scm) != 0 {
+		return r.Scm == ScmHg
+	}
+
+	return strings.HasPrefix(r.Path, "ssh://hg@")
+}
+
+// IsSvn returns true if the Repository is
+// a Subversion repository.
+func (r *Repo) IsSvn() bool {
+	if len(r.Scm) != 0 {
+		return r.Scm == ScmSvn
+	}
+
+	switch {
+	case strings.HasPrefix(r.Path, "svn://"):
+		return true
+	case strings.HasPrefix(r.Path, "svn+ssh://"):
+		return true
+	}
+
+	return false
+}
+
+// SvnPath returns the path of the Subversion branch,
+// relative to the repository root. The trunk and any
+// branch that includes a path, such as tags/1.0, are
+// used as-is, otherwise the branch is assumed to be
+// in the branches directory.
+func (r *Repo) SvnPath() string {
+	switch {
+	case len(r.Branch) == 0:
+		return "trunk"
+	case r.Branch == "trunk", strings.Contains(r.Branch, "/"):
+		return r.Branch
+	default:
+		return "branches/" + r.Branch
+	}
+}
+
 // returns commands that can be used in a Dockerfile
 // to clone the repository.
-//
-// TODO we should also enable Mercurial projects and SVN projects
 func (r *Repo) Commands() []string {
+	switch {
+	case r.IsHg():
+		return r.hgCommands()
+	case r.IsSvn():
+		return r.svnCommands()
+	default:
+		return r.gitCommands()
+	}
+}
+
+// returns commands that can be used in a Dockerfile
+// to clone a Git repository.
+func (r *Repo) gitCommands() []string {
 	// get the branch. default to master
 	// if no branch exists.
 	branch := r.Branch
@@ -102,10 +214,49 @@ func (r *Repo) Commands() []string {
 		branch = "master"
 	}
 
+	// a tag is cloned in place of the branch.
+	if len(r.Tag) != 0 {
+		branch = r.Tag
+	}
+
+	// a pull request that is merged is cloned
+	// from the base branch.
+	if r.IsMerge() {
+		branch = r.BaseBranch
+	}
+
+	// clone submodules recursively, unless
+	// submodules are disabled.
+	recursive := " --recursive"
+	if r.NoSubmodules {
+		recursive = ""
+	}
+
+	clone := fmt.Sprintf("git clone --depth=%d%s --branch=%s %s %s", r.Depth, recursive, branch, r.Path, r.Dir)
+
+	// when a mirror is available the full history is
+	// cloned, since objects are copied from the mirror.
+	if len(r.Mirror) != 0 {
+		clone = fmt.Sprintf("git clone%s --reference=%s --branch=%s %s %s || %s", recursive, r.Mirror, branch, r.Path, r.Dir, clone)
+	}
+
 	cmds := []string{}
-	cmds = append(cmds, fmt.Sprintf("git clone --depth=%d --recursive --branch=%s %s %s", r.Depth, branch, r.Path, r.Dir))
+	cmds = append(cmds, clone)
+
+	if r.Tags {
+		cmds = append(cmds, "git fetch --tags origin")
+	}
 
 	switch {
+	// if the pull request should be merged then
+	// we'll need to merge it into the base commit.
+	case r.IsMerge():
+		pr := "origin/pr/" + r.PR
+		cmds = append(cmds, fmt.Sprintf("git fetch origin +refs/pull/%s/head:refs/remotes/%s", r.PR, pr))
+		cmds = append(cmds, r.fetchCommit(r.BaseCommit)...)
+		cmds = append(cmds, fmt.Sprintf("git checkout -qf -b pr/%s %s", r.PR, r.BaseCommit))
+		cmds = append(cmds, fmt.Sprintf("git merge-base HEAD %s >/dev/null || git fetch --quiet --unshallow origin 2>/dev/null || true", pr))
+		cmds = append(cmds, fmt.Sprintf("git -c user.name=drone -c user.email=drone@localhost merge --quiet --no-edit %s || { echo \"Pull Request #%s can't be merged into %s. Please resolve the merge conflicts.\"; touch %s; exit 1; }", pr, r.PR, r.BaseBranch, MergeConflictFile))
 	// if a specific commit is provided then we'll
 	// need to clone it.
 	case len(r.PR) > 0:
@@ -117,8 +268,71 @@ func (r *Repo) Commands() []string {
 	// if a specific commit is provided then we'll
 	// need to clone it.
 	case len(r.Commit) > 0:
+		cmds = append(cmds, r.fetchCommit(r.Commit)...)
 		cmds = append(cmds, fmt.Sprintf("git checkout -qf %s", r.Commit))
 	}
 
 	return cmds
 }
+
+// returns commands that can be used in a Dockerfile
+// to fetch the commit when it is not included in the
+// shallow clone, for example when several commits are
+// pushed at once, or an older commit is rebuilt. The
+// history is progressively deepened, after which the
+// commit itself is fetched.
+func (r *Repo) fetchCommit(commit string) []string {
+	// each command is skipped once the commit exists
+	exists := fmt.Sprintf("git cat-file -e %s^{commit} 2>/dev/null", commit)
+
+	cmds := []string{}
+	if r.Depth > 0 {
+		cmds = append(cmds, fmt.Sprintf("%s || git fetch --quiet --depth=%d origin 2>/dev/null || true", exists, r.Depth*10))
+		cmds = append(cmds, fmt.Sprintf("%s || git fetch --quiet --unshallow origin 2>/dev/null || true", exists))
+	}
+	cmds = append(cmds, fmt.Sprintf("%s || git fetch --quiet origin %s 2>/dev/null || true", exists, commit))
+	cmds = append(cmds, fmt.Sprintf("%s || { echo \"Commit %s was not found in the repository. It may have been removed by a force push.\"; exit 1; }", exists, commit))
+	return cmds
+}
+
+// IsMerge returns true if the Pull Request should
+// be merged into the base commit.
+func (r *Repo) IsMerge() bool {
+	return r.Merge && len(r.PR) != 0 && len(r.BaseBranch) != 0 && len(r.BaseCommit) != 0
+}
+
+// returns commands that can be used in a Dockerfile
+// to clone a Mercurial repository.
+func (r *Repo) hgCommands() []string {
+	// get the branch. default to default
+	// if no branch exists.
+	branch := r.Branch
+	if len(branch) == 0 {
+		branch = "default"
+	}
+
+	cmds := []string{}
+	cmds = append(cmds, fmt.Sprintf("hg clone --branch=%s %s %s", branch, r.Path, r.Dir))
+
+	// if a specific commit is provided then we'll
+	// need to update the working copy to it.
+	if len(r.Commit) > 0 {
+		cmds = append(cmds, fmt.Sprintf("hg update --clean --rev=%s", r.Commit))
+	}
+
+	return cmds
+}
+
+// returns commands that can be used in a Dockerfile
+// to checkout a Subversion repository.
+func (r *Repo) svnCommands() []string {
+	url := strings.TrimRight(r.Path, "/") + "/" + r.SvnPath()
+
+	// if a specific revision is provided then
+	// we'll need to check it out.
+	if len(r.Commit) > 0 {
+		return []string{fmt.Sprintf("svn checkout --non-interactive --revision=%s %s %s", r.Commit, url, r.Dir)}
+	}
+
+	return []string{fmt.Sprintf("svn checkout --non-interactive %s %s", url, r.Dir)}
+}
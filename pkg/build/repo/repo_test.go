@@ -16,6 +16,8 @@ func TestIsRemote(t *testing.T) {
 		{"http://github.com/foo/far.git", true},
 		{"https://github.com/foo/far.git", true},
 		{"ssh://baz.com/foo/far.git", true},
+		{"svn://gcc.gnu.org/svn/gcc", true},
+		{"svn+ssh://baz.com/foo/far", true},
 		{"/var/lib/src", false},
 		{"/home/ubuntu/src", false},
 		{"src", false},
@@ -52,3 +54,141 @@ func TestIsGit(t *testing.T) {
 		}
 	}
 }
+
+func TestIsGitScm(t *testing.T) {
+	repo := Repo{Path: "https://code.google.com/p/go", Scm: ScmGit}
+	if !repo.IsGit() {
+		t.Errorf("IsGit %s was false, expected true", repo.Path)
+	}
+
+	repo = Repo{Path: "git://github.com/foo/far.git", Scm: ScmHg}
+	if repo.IsGit() {
+		t.Errorf("IsGit %s was true, expected false", repo.Path)
+	}
+}
+
+func TestIsHg(t *testing.T) {
+	repos := []struct {
+		repo Repo
+		hg   bool
+	}{
+		{Repo{Path: "ssh://hg@bitbucket.org/foo/far"}, true},
+		{Repo{Path: "https://code.google.com/p/go", Scm: ScmHg}, true},
+		{Repo{Path: "https://bitbucket.org/foo/far.git"}, false},
+		{Repo{Path: "svn://gcc.gnu.org/svn/gcc"}, false},
+	}
+
+	for _, r := range repos {
+		if hg := r.repo.IsHg(); hg != r.hg {
+			t.Errorf("IsHg %s was %v, expected %v", r.repo.Path, hg, r.hg)
+		}
+	}
+}
+
+func TestIsSvn(t *testing.T) {
+	repos := []struct {
+		repo Repo
+		svn  bool
+	}{
+		{Repo{Path: "svn://gcc.gnu.org/svn/gcc"}, true},
+		{Repo{Path: "svn+ssh://baz.com/foo/far"}, true},
+		{Repo{Path: "https://svn.apache.org/repos/asf/subversion", Scm: ScmSvn}, true},
+		{Repo{Path: "git://github.com/foo/far.git"}, false},
+	}
+
+	for _, r := range repos {
+		if svn := r.repo.IsSvn(); svn != r.svn {
+			t.Errorf("IsSvn %s was %v, expected %v", r.repo.Path, svn, r.svn)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	repos := []struct {
+		repo Repo
+		cmds []string
+	}{
+		{
+			Repo{Path: "git://github.com/foo/far.git", Branch: "dev", Commit: "e7e046b35", Dir: "/src", Depth: 50},
+			[]string{
+				"git clone --depth=50 --recursive --branch=dev git://github.com/foo/far.git /src",
+				"git cat-file -e e7e046b35^{commit} 2>/dev/null || git fetch --quiet --depth=500 origin 2>/dev/null || true",
+				"git cat-file -e e7e046b35^{commit} 2>/dev/null || git fetch --quiet --unshallow origin 2>/dev/null || true",
+				"git cat-file -e e7e046b35^{commit} 2>/dev/null || git fetch --quiet origin e7e046b35 2>/dev/null || true",
+				"git cat-file -e e7e046b35^{commit} 2>/dev/null || { echo \"Commit e7e046b35 was not found in the repository. It may have been removed by a force push.\"; exit 1; }",
+				"git checkout -qf e7e046b35",
+			},
+		},
+		{
+			Repo{Path: "git://github.com/foo/far.git", Branch: "dev", Dir: "/src", Depth: 50, NoSubmodules: true, Tags: true},
+			[]string{
+				"git clone --depth=50 --branch=dev git://github.com/foo/far.git /src",
+				"git fetch --tags origin",
+			},
+		},
+		{
+			Repo{Path: "git://github.com/foo/far.git", Branch: "dev", Commit: "e7e046b35", PR: "5", BaseBranch: "master", BaseCommit: "a2b3c4d5e", Dir: "/src", Merge: true},
+			[]string{
+				"git clone --depth=0 --recursive --branch=master git://github.com/foo/far.git /src",
+				"git fetch origin +refs/pull/5/head:refs/remotes/origin/pr/5",
+				"git cat-file -e a2b3c4d5e^{commit} 2>/dev/null || git fetch --quiet origin a2b3c4d5e 2>/dev/null || true",
+				"git cat-file -e a2b3c4d5e^{commit} 2>/dev/null || { echo \"Commit a2b3c4d5e was not found in the repository. It may have been removed by a force push.\"; exit 1; }",
+				"git checkout -qf -b pr/5 a2b3c4d5e",
+				"git merge-base HEAD origin/pr/5 >/dev/null || git fetch --quiet --unshallow origin 2>/dev/null || true",
+				"git -c user.name=drone -c user.email=drone@localhost merge --quiet --no-edit origin/pr/5 || { echo \"Pull Request #5 can't be merged into master. Please resolve the merge conflicts.\"; touch .git/DRONE_MERGE_CONFLICT; exit 1; }",
+			},
+		},
+		{
+			Repo{Path: "git://github.com/foo/far.git", Branch: "dev", Commit: "e7e046b35", PR: "5", BaseBranch: "master", BaseCommit: "a2b3c4d5e", Dir: "/src"},
+			[]string{
+				"git clone --depth=0 --recursive --branch=dev git://github.com/foo/far.git /src",
+				"git fetch origin +refs/pull/5/head:refs/remotes/origin/pr/5",
+				"git checkout -qf -b pr/5 origin/pr/5",
+			},
+		},
+		{
+			Repo{Path: "git://github.com/foo/far.git", Dir: "/src", Depth: 50, Mirror: "/var/cache/drone/mirror"},
+			[]string{
+				"git clone --recursive --reference=/var/cache/drone/mirror --branch=master git://github.com/foo/far.git /src || git clone --depth=50 --recursive --branch=master git://github.com/foo/far.git /src",
+			},
+		},
+		{
+			Repo{Path: "https://bitbucket.org/foo/far", Commit: "e7e046b35", Dir: "/src", Scm: ScmHg},
+			[]string{
+				"hg clone --branch=default https://bitbucket.org/foo/far /src",
+				"hg update --clean --rev=e7e046b35",
+			},
+		},
+		{
+			Repo{Path: "svn://baz.com/far/", Commit: "1234", Dir: "/src", Scm: ScmSvn},
+			[]string{
+				"svn checkout --non-interactive --revision=1234 svn://baz.com/far/trunk /src",
+			},
+		},
+		{
+			Repo{Path: "svn://baz.com/far", Branch: "1.x", Dir: "/src"},
+			[]string{
+				"svn checkout --non-interactive svn://baz.com/far/branches/1.x /src",
+			},
+		},
+		{
+			Repo{Path: "svn://baz.com/far", Branch: "tags/1.0", Dir: "/src"},
+			[]string{
+				"svn checkout --non-interactive svn://baz.com/far/tags/1.0 /src",
+			},
+		},
+	}
+
+	for _, r := range repos {
+		cmds := r.repo.Commands()
+		if len(cmds) != len(r.cmds) {
+			t.Errorf("Expected commands %v, got %v", r.cmds, cmds)
+			continue
+		}
+		for i := range cmds {
+			if cmds[i] != r.cmds[i] {
+				t.Errorf("Expected command %s, got %s", r.cmds[i], cmds[i])
+			}
+		}
+	}
+}
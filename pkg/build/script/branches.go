@@ -0,0 +1,43 @@
+package script
+
+import (
+	"path"
+)
+
+// Branches stores the configuration details for
+// limiting builds to a set of branches.
+type Branches struct {
+	// Include lists the branches that should be
+	// built, using glob patterns, for example
+	// "release/*". All branches are built if the
+	// list is empty.
+	Include []string `yaml:"include,omitempty"`
+
+	// Exclude lists the branches that should never
+	// be built, using glob patterns. Exclusions take
+	// precedence over inclusions.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// Match returns true if the branch should be built. A
+// nil Branches matches all branches.
+func (b *Branches) Match(branch string) bool {
+	if b == nil {
+		return true
+	}
+	if matchAny(b.Exclude, branch) {
+		return false
+	}
+	return len(b.Include) == 0 || matchAny(b.Include, branch)
+}
+
+// matchAny returns true if the name matches any of
+// the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package script
+
+import (
+	"testing"
+)
+
+var branchesYaml = `
+image: go1.2
+script:
+  - go test
+branches:
+  include:
+    - master
+    - release/*
+  exclude:
+    - release/old
+`
+
+func TestBranchesMatch(t *testing.T) {
+	build, err := ParseBuild([]byte(branchesYaml), nil)
+	if err != nil {
+		t.Fatalf("Can't parse yaml %s", err)
+	}
+
+	expected := map[string]bool{
+		"master":        true,
+		"release/1.0":   true,
+		"release/old":   false,
+		"gh-pages":      false,
+		"feature/login": false,
+	}
+	for branch, match := range expected {
+		if got := build.Branches.Match(branch); got != match {
+			t.Errorf("Expected branch %s match %v, got %v", branch, match, got)
+		}
+	}
+}
+
+func TestBranchesMatchNil(t *testing.T) {
+	var branches *Branches
+	if !branches.Match("gh-pages") {
+		t.Errorf("Expected all branches to match when no branches are specified")
+	}
+}
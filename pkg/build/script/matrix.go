@@ -0,0 +1,122 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Matrix stores the configuration details for
+// expanding a single build configuration into
+// multiple builds, one for each combination of
+// image and environment.
+type Matrix struct {
+	// Image lists the Docker Images that the
+	// build should be executed against.
+	Image []string `yaml:"image,omitempty"`
+
+	// Env lists the environment configurations that
+	// the build should be executed against. Each entry
+	// may contain multiple, space-separated variables,
+	// for example, "DB=mysql RAILS_ENV=test".
+	Env []string `yaml:"env,omitempty"`
+
+	// Include lists additional image and environment
+	// combinations that should be built.
+	Include []*Axis `yaml:"include,omitempty"`
+
+	// Exclude lists image and environment combinations
+	// that should be removed from the matrix.
+	Exclude []*Axis `yaml:"exclude,omitempty"`
+}
+
+// Axis represents a single combination of image
+// and environment in the build matrix.
+type Axis struct {
+	Image string `yaml:"image,omitempty"`
+	Env   string `yaml:"env,omitempty"`
+}
+
+// Axes returns the list of image and environment
+// combinations defined by the matrix, with all
+// exclusions removed and inclusions appended.
+func (m *Matrix) Axes() []*Axis {
+	images := m.Image
+	if len(images) == 0 {
+		images = []string{""}
+	}
+	envs := m.Env
+	if len(envs) == 0 {
+		envs = []string{""}
+	}
+
+	var axes []*Axis
+	for _, image := range images {
+		for _, env := range envs {
+			axis := &Axis{Image: image, Env: env}
+			if m.isExcluded(axis) {
+				continue
+			}
+			axes = append(axes, axis)
+		}
+	}
+
+	return append(axes, m.Include...)
+}
+
+// isExcluded returns true if the axis matches one
+// of the exclusion rules. An exclusion rule with an
+// empty image or environment matches any value.
+func (m *Matrix) isExcluded(axis *Axis) bool {
+	for _, rule := range m.Exclude {
+		if len(rule.Image) != 0 && rule.Image != axis.Image {
+			continue
+		}
+		if len(rule.Env) != 0 && rule.Env != axis.Env {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Builds expands the build matrix into a list of
+// builds. If no matrix is specified a list containing
+// only the current build is returned.
+func (b *Build) Builds() []*Build {
+	if b.Matrix == nil {
+		return []*Build{b}
+	}
+
+	var builds []*Build
+	for _, axis := range b.Matrix.Axes() {
+		builds = append(builds, b.expand(axis))
+	}
+	return builds
+}
+
+// expand creates a copy of the build for the
+// given image and environment combination.
+func (b *Build) expand(axis *Axis) *Build {
+	build := *b
+	build.Matrix = nil
+
+	if len(axis.Image) != 0 {
+		build.Image = axis.Image
+	}
+
+	// copy the environment so that the matrix
+	// variables are not shared between builds
+	build.Env = make([]string, len(b.Env))
+	copy(build.Env, b.Env)
+	build.Env = append(build.Env, strings.Fields(axis.Env)...)
+
+	// generate a label for the build, unless a
+	// name was explicitly provided.
+	name := strings.TrimSpace(fmt.Sprintf("%s %s", build.Image, axis.Env))
+	if len(b.Name) != 0 {
+		name = fmt.Sprintf("%s (%s)", b.Name, name)
+	}
+	build.Name = name
+
+	return &build
+}
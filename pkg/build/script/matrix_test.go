@@ -0,0 +1,73 @@
+package script
+
+import (
+	"testing"
+)
+
+var matrixYaml = `
+image: go1.2
+script:
+  - go test
+env:
+  - GOPATH=/var/cache/drone
+matrix:
+  image:
+    - go1.1
+    - go1.2
+  env:
+    - DB=mysql
+    - DB=postgres
+  exclude:
+    - image: go1.1
+      env: DB=postgres
+  include:
+    - image: go1.3
+      env: DB=sqlite
+`
+
+func TestBuilds(t *testing.T) {
+	build, err := ParseBuild([]byte(matrixYaml), nil)
+	if err != nil {
+		t.Fatalf("Can't parse yaml %s", err)
+	}
+
+	builds := build.Builds()
+	if len(builds) != 4 {
+		t.Fatalf("Expected 4 builds in the matrix, got %d", len(builds))
+	}
+
+	expected := []struct {
+		image, env string
+	}{
+		{"go1.1", "DB=mysql"},
+		{"go1.2", "DB=mysql"},
+		{"go1.2", "DB=postgres"},
+		{"go1.3", "DB=sqlite"},
+	}
+
+	for i, e := range expected {
+		b := builds[i]
+		if b.Image != e.image {
+			t.Errorf("Expected image %s, got %s", e.image, b.Image)
+		}
+		if len(b.Env) != 2 || b.Env[0] != "GOPATH=/var/cache/drone" || b.Env[1] != e.env {
+			t.Errorf("Expected env [GOPATH=/var/cache/drone %s], got %v", e.env, b.Env)
+		}
+		if b.Matrix != nil {
+			t.Errorf("Expected matrix to be removed from the expanded build")
+		}
+	}
+
+	// the original environment should not be modified
+	if len(build.Env) != 1 {
+		t.Errorf("Expected the original build env to be unchanged, got %v", build.Env)
+	}
+}
+
+func TestBuildsNoMatrix(t *testing.T) {
+	build := &Build{Image: "go1.2"}
+	builds := build.Builds()
+	if len(builds) != 1 || builds[0] != build {
+		t.Errorf("Expected a single build when no matrix is specified")
+	}
+}
@@ -0,0 +1,53 @@
+package script
+
+import (
+	"path"
+)
+
+// Paths stores the configuration details for
+// limiting builds to commits that change a set
+// of files, which is useful for repositories that
+// contain multiple projects.
+type Paths struct {
+	// Include lists the files that should trigger a
+	// build when changed, using glob patterns. A pattern
+	// that matches a directory includes all of the files
+	// in the directory, for example "services/api". All
+	// files are included if the list is empty.
+	Include []string `yaml:"include,omitempty"`
+
+	// Exclude lists the files that should never trigger
+	// a build when changed, using glob patterns. Exclusions
+	// take precedence over inclusions.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// Match returns true if any of the changed files should
+// trigger a build. A nil Paths, or an empty list of files,
+// always matches, since we can't tell which files changed.
+func (p *Paths) Match(files []string) bool {
+	if p == nil || len(files) == 0 {
+		return true
+	}
+	for _, file := range files {
+		if matchAnyPath(p.Exclude, file) {
+			continue
+		}
+		if len(p.Include) == 0 || matchAnyPath(p.Include, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyPath returns true if the file, or any of the
+// directories that contain the file, matches any of the
+// glob patterns.
+func matchAnyPath(patterns []string, file string) bool {
+	for name := path.Clean(file); name != "." && name != "/"; name = path.Dir(name) {
+		if matchAny(patterns, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package script
+
+import (
+	"testing"
+)
+
+var pathsYaml = `
+image: go1.2
+script:
+  - go test
+paths:
+  include:
+    - services/api
+    - "*.go"
+  exclude:
+    - services/api/docs
+`
+
+func TestPathsMatch(t *testing.T) {
+	build, err := ParseBuild([]byte(pathsYaml), nil)
+	if err != nil {
+		t.Fatalf("Can't parse yaml %s", err)
+	}
+
+	expected := []struct {
+		files []string
+		match bool
+	}{
+		{[]string{"services/api/main.go"}, true},
+		{[]string{"services/api/docs/index.md"}, false},
+		{[]string{"services/web/index.html"}, false},
+		{[]string{"services/web/index.html", "services/api/main.go"}, true},
+		{[]string{"main.go"}, true},
+		{[]string{"README.md"}, false},
+		{[]string{}, true},
+	}
+	for _, e := range expected {
+		if got := build.Paths.Match(e.files); got != e.match {
+			t.Errorf("Expected files %v match %v, got %v", e.files, e.match, got)
+		}
+	}
+}
+
+func TestPathsMatchNil(t *testing.T) {
+	var paths *Paths
+	if !paths.Match([]string{"README.md"}) {
+		t.Errorf("Expected all files to match when no paths are specified")
+	}
+}
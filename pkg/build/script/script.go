@@ -15,8 +15,12 @@ import (
 	"github.com/drone/drone/pkg/plugin/publish"
 )
 
+// NetworkShared is the network mode where the build and
+// service containers share a network namespace.
+const NetworkShared = "shared"
+
 func ParseBuild(data []byte, params map[string]string) (*Build, error) {
-	build := Build{}
+	build := Build{Raw: data}
 
 	// parse the build configuration file
 	err := goyaml.Unmarshal(injectParams(data, params), &build)
@@ -43,10 +47,30 @@ func injectParams(data []byte, params map[string]string) []byte {
 // Build stores the configuration details for
 // building, testing and deploying code.
 type Build struct {
+	// Raw stores the build configuration file, before
+	// the params were injected.
+	Raw []byte `yaml:"-" json:"-"`
+
 	// Image specifies the Docker Image that will be
 	// used to virtualize the Build process.
 	Image string
 
+	// User specifies the user that runs the build
+	// inside the container. If empty, the user is
+	// detected by inspecting the Image.
+	User string `yaml:"user,omitempty"`
+
+	// Home specifies the home directory of the User.
+	Home string `yaml:"home,omitempty"`
+
+	// Shell specifies the shell used to execute the
+	// build script, such as /bin/bash or /bin/sh.
+	Shell string `yaml:"shell,omitempty"`
+
+	// Workdir specifies the directory, relative to the
+	// repository, where the build commands are executed.
+	Workdir string `yaml:"workdir,omitempty"`
+
 	// Name specifies a user-defined label used
 	// to identify the build.
 	Name string
@@ -68,7 +92,21 @@ type Build struct {
 	// Services specifies external services, such as
 	// database or messaging queues, that should be
 	// linked to the build environment.
-	Services []string
+	Services []*Service
+
+	// Network specifies how the services are reached
+	// from the build environment. If "shared", the build
+	// and service containers share a network namespace,
+	// and the services are reachable on localhost.
+	Network string `yaml:"network,omitempty"`
+
+	// Branches limits the branches that are built
+	// when a commit is pushed to the repository.
+	Branches *Branches `yaml:"branches,omitempty"`
+
+	// Paths limits the builds to commits that change
+	// the listed files.
+	Paths *Paths `yaml:"paths,omitempty"`
 
 	Deploy        *deploy.Deploy       `yaml:"deploy,omitempty"`
 	Publish       *publish.Publish     `yaml:"publish,omitempty"`
@@ -77,21 +115,28 @@ type Build struct {
 	// Git specified git-specific parameters, such as
 	// the clone depth and path
 	Git *git.Git `yaml:"git,omitempty"`
+
+	// Matrix specifies a list of images and environment
+	// configurations that the build should be expanded
+	// into, resulting in multiple builds.
+	Matrix *Matrix `yaml:"matrix,omitempty"`
 }
 
 // Write adds all the steps to the build script, including
-// build commands, deploy and publish commands.
-func (b *Build) Write(f *buildfile.Buildfile) {
+// build commands, deploy and publish commands. Deploy and
+// publish commands that are limited to tags are omitted,
+// unless the build is for a tag.
+func (b *Build) Write(f *buildfile.Buildfile, tag bool) {
 	// append build commands
 	b.WriteBuild(f)
 
 	// write publish commands
-	if b.Publish != nil {
+	if b.Publish != nil && (tag || !b.Publish.Tag) {
 		b.Publish.Write(f)
 	}
 
 	// write deployment commands
-	if b.Deploy != nil {
+	if b.Deploy != nil && (tag || !b.Deploy.Tag) {
 		b.Deploy.Write(f)
 	}
 
@@ -0,0 +1,24 @@
+package script
+
+import (
+	"testing"
+)
+
+func TestParseBuildParams(t *testing.T) {
+	raw := []byte("image: go1.2\nenv:\n  - TOKEN={{TOKEN}}\n")
+	build, err := ParseBuild(raw, map[string]string{"TOKEN": "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the params are injected into the build
+	if len(build.Env) != 1 || build.Env[0] != "TOKEN=s3cr3t" {
+		t.Errorf("Expected params injected into the build, got %v", build.Env)
+	}
+
+	// the raw build configuration is kept without
+	// the params, so that they are never stored.
+	if string(build.Raw) != string(raw) {
+		t.Errorf("Expected raw build configuration %q, got %q", raw, build.Raw)
+	}
+}
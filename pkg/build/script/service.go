@@ -0,0 +1,77 @@
+package script
+
+import (
+	"launchpad.net/goyaml"
+)
+
+// Service stores the configuration details for an
+// external service, such as a database or messaging
+// queue, that is linked to the build environment.
+//
+// A service may be specified using the name of a
+// preset service, for example "redis", or using a
+// Docker image and its configuration.
+type Service struct {
+	// Image specifies the Docker image of the
+	// service, or the name of a preset service.
+	Image string `yaml:"image,omitempty"`
+
+	// Ports lists the ports the service listens on,
+	// for example, 5432 for postgres.
+	Ports []string `yaml:"ports,omitempty"`
+
+	// Env specifies the environment of the service
+	// container, for example, POSTGRES_DB=test.
+	Env []string `yaml:"env,omitempty"`
+
+	// Command overrides the default command of the
+	// service image.
+	Command []string `yaml:"command,omitempty"`
+
+	// Alias specifies the hostname that is used to
+	// link the service to the build container.
+	Alias string `yaml:"alias,omitempty"`
+
+	// Ready specifies how to check that the service
+	// is ready, before the build is started.
+	Ready *Ready `yaml:"ready,omitempty"`
+}
+
+// Ready stores the configuration details for checking
+// that a service is ready to accept connections. By
+// default, a service is ready once the first of its
+// ports accepts TCP connections.
+type Ready struct {
+	// HTTP specifies a path that is requested from the
+	// first port of the service, for example "/health".
+	// The service is ready once the request succeeds.
+	HTTP string `yaml:"http,omitempty"`
+
+	// Command specifies a command that is run inside
+	// the service container. The service is ready once
+	// the command exits with a zero status.
+	Command []string `yaml:"command,omitempty"`
+
+	// Timeout is the number of seconds to wait for
+	// the service to become ready. The default is 60.
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// SetYAML allows a service to be specified as a string,
+// which is the name of a preset service or an image, or
+// as a map of the service configuration.
+func (s *Service) SetYAML(tag string, value interface{}) bool {
+	if image, ok := value.(string); ok {
+		s.Image = image
+		return true
+	}
+
+	// the value is re-encoded, so that the service
+	// configuration is decoded using the yaml tags.
+	raw, err := goyaml.Marshal(value)
+	if err != nil {
+		return false
+	}
+	type service Service
+	return goyaml.Unmarshal(raw, (*service)(s)) == nil
+}
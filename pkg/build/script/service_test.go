@@ -0,0 +1,61 @@
+package script
+
+import (
+	"testing"
+)
+
+var servicesYaml = `
+image: go1.2
+script:
+  - go test
+services:
+  - redis
+  - image: postgres:9.3
+    alias: db
+    ports:
+      - 5432
+    env:
+      - POSTGRES_DB=test
+    command:
+      - postgres
+      - -F
+    ready:
+      command:
+        - pg_isready
+      timeout: 30
+`
+
+func TestServices(t *testing.T) {
+	build, err := ParseBuild([]byte(servicesYaml), nil)
+	if err != nil {
+		t.Fatalf("Can't parse yaml %s", err)
+	}
+
+	if len(build.Services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(build.Services))
+	}
+
+	if build.Services[0].Image != "redis" {
+		t.Errorf("Expected preset service redis, got %s", build.Services[0].Image)
+	}
+
+	service := build.Services[1]
+	if service.Image != "postgres:9.3" {
+		t.Errorf("Expected service image postgres:9.3, got %s", service.Image)
+	}
+	if service.Alias != "db" {
+		t.Errorf("Expected service alias db, got %s", service.Alias)
+	}
+	if len(service.Ports) != 1 || service.Ports[0] != "5432" {
+		t.Errorf("Expected service ports [5432], got %v", service.Ports)
+	}
+	if len(service.Env) != 1 || service.Env[0] != "POSTGRES_DB=test" {
+		t.Errorf("Expected service env [POSTGRES_DB=test], got %v", service.Env)
+	}
+	if len(service.Command) != 2 || service.Command[0] != "postgres" || service.Command[1] != "-F" {
+		t.Errorf("Expected service command [postgres -F], got %v", service.Command)
+	}
+	if service.Ready == nil || len(service.Ready.Command) != 1 || service.Ready.Timeout != 30 {
+		t.Errorf("Expected service ready command [pg_isready] with timeout 30, got %v", service.Ready)
+	}
+}
@@ -0,0 +1,143 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone/pkg/build/docker"
+)
+
+// resolveUser sets the user, home directory and shell
+// used to run the build, when they are not specified in
+// the build configuration, by inspecting the build image.
+func (b *Builder) resolveUser(image *docker.Image) {
+	config := &docker.Config{}
+	if image != nil && image.Config != nil {
+		config = image.Config
+	}
+
+	// the official Drone images don't specify a user,
+	// however, they are meant to run as the "ubuntu" user
+	// since all build images inherit from the ubuntu
+	// cloud ISO.
+	official := strings.HasPrefix(b.Build.Image, "bradrydzewski/") ||
+		strings.HasPrefix(b.Build.Image, "drone/")
+
+	if len(b.Build.User) == 0 {
+		switch {
+		case len(config.User) != 0:
+			b.Build.User = config.User
+		case official:
+			b.Build.User = "ubuntu"
+		default:
+			b.Build.User = "root"
+		}
+	}
+
+	if len(b.Build.Home) == 0 {
+		switch {
+		case b.Build.User == config.User && len(getEnv(config.Env, "HOME")) != 0:
+			b.Build.Home = getEnv(config.Env, "HOME")
+		case isRoot(b.Build.User):
+			b.Build.Home = "/root"
+		default:
+			b.Build.Home = "/home/" + userName(b.Build.User)
+		}
+	}
+
+	// if the shell is still unknown it is detected when
+	// the build container starts.
+	if len(b.Build.Shell) == 0 {
+		switch {
+		case len(getEnv(config.Env, "SHELL")) != 0:
+			b.Build.Shell = getEnv(config.Env, "SHELL")
+		case official:
+			b.Build.Shell = "/bin/bash"
+		}
+	}
+}
+
+// containerEnv returns the environment variables of
+// the build container, in the key=value format.
+func (b *Builder) containerEnv() []string {
+	env := []string{
+		"HOME=" + b.Build.Home,
+		"LANG=en_US.UTF-8",
+		"LANGUAGE=en_US:en",
+		"LOGNAME=" + userName(b.Build.User),
+		"TERM=xterm",
+	}
+	if len(b.Build.Shell) != 0 {
+		env = append(env, "SHELL="+b.Build.Shell)
+	}
+	if isRoot(b.Build.User) {
+		env = append(env, "GOPATH=/var/cache/drone")
+	}
+	return env
+}
+
+// entrypoint returns the command used to execute the
+// build script. If the shell is unknown bash is used
+// when it is installed, otherwise the POSIX shell.
+func (b *Builder) entrypoint(script string) string {
+	if len(b.Build.Shell) != 0 {
+		return fmt.Sprintf("%s -e %s", b.Build.Shell, script)
+	}
+	return fmt.Sprintf("[ -x /bin/bash ] && exec /bin/bash -e %s || exec /bin/sh -e %s", script, script)
+}
+
+// workdir returns the directory where the build commands
+// are executed. Relative paths are resolved against the
+// repository directory.
+func (b *Builder) workdir() string {
+	switch {
+	case len(b.Build.Workdir) == 0:
+		return b.Repo.Dir
+	case filepath.IsAbs(b.Build.Workdir):
+		return filepath.Clean(b.Build.Workdir)
+	default:
+		return filepath.Join(b.Repo.Dir, b.Build.Workdir)
+	}
+}
+
+// systemDirs lists the directories of the build image
+// that are never owned by the build user.
+var systemDirs = map[string]bool{
+	"/": true, "/bin": true, "/boot": true, "/dev": true, "/etc": true,
+	"/home": true, "/lib": true, "/lib64": true, "/opt": true, "/proc": true,
+	"/root": true, "/run": true, "/sbin": true, "/srv": true, "/sys": true,
+	"/tmp": true, "/usr": true, "/usr/bin": true, "/usr/lib": true,
+	"/usr/local": true, "/usr/local/bin": true, "/usr/sbin": true,
+	"/var": true, "/var/cache": true, "/var/lib": true, "/var/cache/drone": true,
+	"/var/cache/drone/src": true,
+}
+
+// isSystemDir returns true if the directory is a system
+// directory of the build image.
+func isSystemDir(dir string) bool {
+	return systemDirs[filepath.Clean(dir)]
+}
+
+// userName returns the name of the user, without the
+// group, from a user in the user[:group] format.
+func userName(user string) string {
+	return strings.SplitN(user, ":", 2)[0]
+}
+
+// isRoot returns true if the user is the root user.
+func isRoot(user string) bool {
+	name := userName(user)
+	return name == "root" || name == "0"
+}
+
+// getEnv returns the value of the environment variable
+// from a list of variables in the key=value format.
+func getEnv(env []string, key string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			return e[len(key)+1:]
+		}
+	}
+	return ""
+}
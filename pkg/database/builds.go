@@ -10,15 +10,15 @@ const buildTable = "builds"
 
 // SQL Queries to retrieve a list of all Commits belonging to a Repo.
 const buildStmt = `
-SELECT id, commit_id, slug, status, started, finished, duration, created, updated, stdout
+SELECT id, commit_id, slug, attempt, status, started, finished, duration, created, updated, stdout, config, axis
 FROM builds
 WHERE commit_id = ?
-ORDER BY slug ASC
+ORDER BY id ASC
 `
 
 // SQL Queries to retrieve a Build by id.
 const buildFindStmt = `
-SELECT id, commit_id, slug, status, started, finished, duration, created, updated, stdout
+SELECT id, commit_id, slug, attempt, status, started, finished, duration, created, updated, stdout, config, axis
 FROM builds
 WHERE id = ?
 LIMIT 1
@@ -26,12 +26,37 @@ LIMIT 1
 
 // SQL Queries to retrieve a Commit by name and repo id.
 const buildFindSlugStmt = `
-SELECT id, commit_id, slug, status, started, finished, duration, created, updated, stdout
+SELECT id, commit_id, slug, attempt, status, started, finished, duration, created, updated, stdout, config, axis
 FROM builds
 WHERE slug = ? AND commit_id = ?
 LIMIT 1
 `
 
+// SQL Queries to retrieve a list of all queued and running Builds.
+const buildQueueStmt = `
+SELECT id, commit_id, slug, attempt, status, started, finished, duration, created, updated, stdout, config, axis
+FROM builds
+WHERE status IN ('Pending', 'Started')
+ORDER BY id ASC
+`
+
+// SQL Queries to retrieve the oldest Pending Build.
+const buildPendingStmt = `
+SELECT id
+FROM builds
+WHERE status = 'Pending'
+ORDER BY id ASC
+LIMIT 1
+`
+
+// SQL Queries to claim a Pending Build. The status is only updated
+// if the Build is still Pending, to prevent multiple workers from
+// claiming the same Build.
+const buildClaimStmt = `
+UPDATE builds SET status = 'Started'
+WHERE id = ? AND status = 'Pending'
+`
+
 // SQL Queries to delete a Commit.
 const buildDeleteStmt = `
 DELETE FROM builds WHERE id = ?
@@ -62,6 +87,39 @@ func DeleteBuild(id int64) error {
 	return err
 }
 
+// Claims the oldest Pending Build, updating its status to
+// Started. Returns sql.ErrNoRows if no Builds are Pending.
+func ClaimBuild() (*Build, error) {
+	for {
+		var id int64
+		if err := db.QueryRow(buildPendingStmt).Scan(&id); err != nil {
+			return nil, err
+		}
+
+		res, err := db.Exec(buildClaimStmt, id)
+		if err != nil {
+			return nil, err
+		}
+
+		// if no rows were updated the Build was
+		// claimed by another worker, so we try
+		// again with the next Pending Build.
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			return GetBuild(id)
+		}
+	}
+}
+
+// Returns a list of all Builds that are
+// Pending or Started.
+func ListBuildsQueue() ([]*Build, error) {
+	var builds []*Build
+	err := meddler.QueryAll(db, &builds, buildQueueStmt)
+	return builds, err
+}
+
 // Returns a list of all Builds associated
 // with the specified Commit ID and branch.
 func ListBuilds(id int64) ([]*Build, error) {
@@ -12,8 +12,8 @@ const commitTable = "commits"
 
 // SQL Queries to retrieve a list of all Commits belonging to a Repo.
 const commitStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE repo_id = ? AND branch = ?
 ORDER BY created DESC
@@ -22,8 +22,8 @@ LIMIT 10
 
 // SQL Queries to retrieve the latest Commit.
 const commitLatestStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE repo_id = ? AND branch = ?
 ORDER BY created DESC
@@ -32,16 +32,16 @@ LIMIT 1
 
 // SQL Queries to retrieve a Commit by id.
 const commitFindStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE id = ?
 `
 
 // SQL Queries to retrieve a Commit by name and repo id.
 const commitFindHashStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE hash = ? AND repo_id = ?
 LIMIT 1
@@ -81,8 +81,8 @@ DELETE FROM commits WHERE id = ?
 
 // SQL Queries to retrieve the latest Commits for each branch.
 const commitBranchesStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE id IN (
     SELECT MAX(id)
@@ -94,14 +94,15 @@ WHERE id IN (
 
 // SQL Queries to retrieve the latest Commits for each branch.
 const commitBranchStmt = `
-SELECT id, repo_id, status, started, finished, duration,
-hash, branch, pull_request, author, gravatar, timestamp, message, created, updated
+SELECT id, repo_id, status, started, finished, duration, attempts,
+hash, branch, tag, pull_request, base_branch, base_hash, untrusted, author, gravatar, timestamp, message, files, created, updated
 FROM commits
 WHERE id IN (
     SELECT MAX(id)
     FROM commits
     WHERE repo_id = ?
     AND   branch  = ? 
+    AND   status != 'Skipped'
     GROUP BY branch)
 LIMIT 1
  `
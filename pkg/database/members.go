@@ -58,6 +58,14 @@ func IsMemberAdmin(user, team int64) (bool, error) {
 	return role.Role == RoleAdmin || role.Role == RoleOwner, err
 }
 
+// Returns true is the user is a member of the team
+// with write access to the team's repositories.
+func IsMemberWrite(user, team int64) (bool, error) {
+	role := Role{}
+	err := meddler.QueryRow(db, &role, roleFindStmt, user, team)
+	return role.Role == RoleWrite || role.Role == RoleAdmin || role.Role == RoleOwner, err
+}
+
 // Creates a new Member.
 func SaveMember(user, team int64, role string) error {
 	r := Role{}
@@ -0,0 +1,27 @@
+package migrate
+
+type Rev4 struct{}
+
+var BuildQueue = &Rev4{}
+
+func (r *Rev4) Revision() int64 {
+	return 201403101002
+}
+
+func (r *Rev4) Up(op Operation) error {
+	_, err := op.AddColumn("builds", "config BLOB")
+	if err != nil {
+		return err
+	}
+	_, err = op.Exec("CREATE INDEX builds_status_ix ON builds (status)")
+	return err
+}
+
+func (r *Rev4) Down(op Operation) error {
+	_, err := op.Exec("DROP INDEX builds_status_ix")
+	if err != nil {
+		return err
+	}
+	_, err = op.DropColumns("builds", []string{"config"})
+	return err
+}
@@ -0,0 +1,19 @@
+package migrate
+
+type Rev5 struct{}
+
+var BuildAttempts = &Rev5{}
+
+func (r *Rev5) Revision() int64 {
+	return 201403121420
+}
+
+func (r *Rev5) Up(op Operation) error {
+	_, err := op.AddColumn("builds", "attempt INTEGER")
+	return err
+}
+
+func (r *Rev5) Down(op Operation) error {
+	_, err := op.DropColumns("builds", []string{"attempt"})
+	return err
+}
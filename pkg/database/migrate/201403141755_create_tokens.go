@@ -0,0 +1,31 @@
+package migrate
+
+type Rev6 struct{}
+
+var CreateTokens = &Rev6{}
+
+func (r *Rev6) Revision() int64 {
+	return 201403141755
+}
+
+func (r *Rev6) Up(op Operation) error {
+	_, err := op.CreateTable("tokens", []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"user_id INTEGER",
+		"name VARCHAR(255)",
+		"token VARCHAR(255) UNIQUE",
+		"read_only BOOLEAN",
+		"created TIMESTAMP",
+		"updated TIMESTAMP",
+	})
+	if err != nil {
+		return err
+	}
+	_, err = op.Exec("CREATE INDEX tokens_user_ix ON tokens (user_id)")
+	return err
+}
+
+func (r *Rev6) Down(op Operation) error {
+	_, err := op.DropTable("tokens")
+	return err
+}
@@ -0,0 +1,23 @@
+package migrate
+
+type Rev7 struct{}
+
+var PullRequestBase = &Rev7{}
+
+func (r *Rev7) Revision() int64 {
+	return 201403171200
+}
+
+func (r *Rev7) Up(op Operation) error {
+	_, err := op.AddColumn("commits", "base_branch VARCHAR(255)")
+	if err != nil {
+		return err
+	}
+	_, err = op.AddColumn("commits", "base_hash VARCHAR(255)")
+	return err
+}
+
+func (r *Rev7) Down(op Operation) error {
+	_, err := op.DropColumns("commits", []string{"base_branch", "base_hash"})
+	return err
+}
@@ -0,0 +1,19 @@
+package migrate
+
+type Rev8 struct{}
+
+var UntrustedCommits = &Rev8{}
+
+func (r *Rev8) Revision() int64 {
+	return 201403181510
+}
+
+func (r *Rev8) Up(op Operation) error {
+	_, err := op.AddColumn("commits", "untrusted BOOLEAN")
+	return err
+}
+
+func (r *Rev8) Down(op Operation) error {
+	_, err := op.DropColumns("commits", []string{"untrusted"})
+	return err
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"github.com/dchest/uniuri"
+)
+
+type Rev9 struct{}
+
+var RepoHookSecret = &Rev9{}
+
+func (r *Rev9) Revision() int64 {
+	return 201403191130
+}
+
+func (r *Rev9) Up(op Operation) error {
+	_, err := op.AddColumn("repos", "hook_secret VARCHAR(255)")
+	if err != nil {
+		return err
+	}
+	_, err = op.AddColumn("repos", "hook_outdated BOOLEAN")
+	if err != nil {
+		return err
+	}
+
+	rows, err := op.Query("SELECT id, host FROM repos")
+	if err != nil {
+		return err
+	}
+	hosts := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var host string
+		if err := rows.Scan(&id, &host); err != nil {
+			rows.Close()
+			return err
+		}
+		hosts[id] = host
+	}
+	rows.Close()
+
+	// existing repositories get a secret, and the GitHub hooks
+	// are flagged until they are reset with the new secret, since
+	// GitHub doesn't sign the payload yet.
+	for id, host := range hosts {
+		outdated := host != "bitbucket.org" && host != "custom"
+		_, err = op.Exec("UPDATE repos SET hook_secret=?, hook_outdated=? WHERE id=?", uniuri.NewLen(40), outdated, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rev9) Down(op Operation) error {
+	_, err := op.DropColumns("repos", []string{"hook_secret", "hook_outdated"})
+	return err
+}
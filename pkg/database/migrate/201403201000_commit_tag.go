@@ -0,0 +1,19 @@
+package migrate
+
+type Rev10 struct{}
+
+var CommitTag = &Rev10{}
+
+func (r *Rev10) Revision() int64 {
+	return 201403201000
+}
+
+func (r *Rev10) Up(op Operation) error {
+	_, err := op.AddColumn("commits", "tag VARCHAR(255)")
+	return err
+}
+
+func (r *Rev10) Down(op Operation) error {
+	_, err := op.DropColumns("commits", []string{"tag"})
+	return err
+}
@@ -0,0 +1,19 @@
+package migrate
+
+type Rev11 struct{}
+
+var CommitFiles = &Rev11{}
+
+func (r *Rev11) Revision() int64 {
+	return 201403211400
+}
+
+func (r *Rev11) Up(op Operation) error {
+	_, err := op.AddColumn("commits", "files TEXT")
+	return err
+}
+
+func (r *Rev11) Down(op Operation) error {
+	_, err := op.DropColumns("commits", []string{"files"})
+	return err
+}
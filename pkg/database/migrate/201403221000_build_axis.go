@@ -0,0 +1,26 @@
+package migrate
+
+type Rev12 struct{}
+
+var BuildAxis = &Rev12{}
+
+func (r *Rev12) Revision() int64 {
+	return 201403221000
+}
+
+func (r *Rev12) Up(op Operation) error {
+	if _, err := op.AddColumn("builds", "axis INTEGER"); err != nil {
+		return err
+	}
+
+	// the build instructions of finished builds were stored
+	// with the repository params injected, and are removed
+	// so that the params are not kept in plain text.
+	_, err := op.Exec("UPDATE builds SET config = NULL WHERE status NOT IN ('Pending', 'Started')")
+	return err
+}
+
+func (r *Rev12) Down(op Operation) error {
+	_, err := op.DropColumns("builds", []string{"axis"})
+	return err
+}
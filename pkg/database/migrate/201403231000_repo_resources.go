@@ -0,0 +1,22 @@
+package migrate
+
+type Rev13 struct{}
+
+var RepoResources = &Rev13{}
+
+func (r *Rev13) Revision() int64 {
+	return 201403231000
+}
+
+func (r *Rev13) Up(op Operation) error {
+	if _, err := op.AddColumn("repos", "memory INTEGER"); err != nil {
+		return err
+	}
+	_, err := op.AddColumn("repos", "cpu_shares INTEGER")
+	return err
+}
+
+func (r *Rev13) Down(op Operation) error {
+	_, err := op.DropColumns("repos", []string{"memory", "cpu_shares"})
+	return err
+}
@@ -5,6 +5,16 @@ func (m *Migration) All() *Migration {
 	// List all migrations here
 	m.Add(RenamePrivelegedToPrivileged)
 	m.Add(GitHubEnterpriseSupport)
+	m.Add(BuildQueue)
+	m.Add(BuildAttempts)
+	m.Add(CreateTokens)
+	m.Add(PullRequestBase)
+	m.Add(UntrustedCommits)
+	m.Add(RepoHookSecret)
+	m.Add(CommitTag)
+	m.Add(CommitFiles)
+	m.Add(BuildAxis)
+	m.Add(RepoResources)
 
 	// m.Add(...)
 	// ...
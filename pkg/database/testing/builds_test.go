@@ -1,9 +1,11 @@
 package database
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
 )
 
 func TestGetBuild(t *testing.T) {
@@ -118,9 +120,10 @@ func TestListBuilds(t *testing.T) {
 		return
 	}
 
-	// get the first user in the list and verify
-	// fields are being populated correctly
-	build := builds[1]
+	// get the first build in the list and verify
+	// fields are being populated correctly. builds
+	// are listed in the order they were created.
+	build := builds[0]
 
 	if build.ID != 1 {
 		t.Errorf("Exepected ID %d, got %d", 1, build.ID)
@@ -134,3 +137,63 @@ func TestListBuilds(t *testing.T) {
 		t.Errorf("Exepected Status %s, got %s", "Success", build.Status)
 	}
 }
+
+func TestClaimBuild(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	// no builds should be pending
+	if _, err := database.ClaimBuild(); err != sql.ErrNoRows {
+		t.Errorf("Exepected sql.ErrNoRows, got %v", err)
+	}
+
+	// add a build to the queue
+	pending := &Build{CommitID: 1, Slug: "node_0.11", Status: "Pending", Config: "image: node0.11", Axis: 1}
+	if err := database.SaveBuild(pending); err != nil {
+		t.Error(err)
+	}
+
+	build, err := database.ClaimBuild()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if build.ID != pending.ID {
+		t.Errorf("Exepected ID %d, got %d", pending.ID, build.ID)
+	}
+
+	if build.Status != "Started" {
+		t.Errorf("Exepected Status %s, got %s", "Started", build.Status)
+	}
+
+	if build.Config != pending.Config {
+		t.Errorf("Exepected Config %s, got %s", pending.Config, build.Config)
+	}
+
+	if build.Axis != pending.Axis {
+		t.Errorf("Exepected Axis %d, got %d", pending.Axis, build.Axis)
+	}
+
+	// the build cannot be claimed twice
+	if _, err := database.ClaimBuild(); err != sql.ErrNoRows {
+		t.Errorf("Exepected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestListBuildsQueue(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	database.SaveBuild(&Build{CommitID: 1, Slug: "node_0.11", Status: "Pending"})
+	database.SaveBuild(&Build{CommitID: 2, Slug: "node_0.11", Status: "Started"})
+
+	builds, err := database.ListBuildsQueue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(builds) != 2 {
+		t.Errorf("Exepected %d builds in queue, got %d", 2, len(builds))
+	}
+}
@@ -82,6 +82,32 @@ func TestIsMemberAdmin(t *testing.T) {
 	}
 }
 
+func TestIsMemberWrite(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	// expecting user is Owner
+	if ok, err := database.IsMemberWrite(1, 1); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Errorf("Expected IsMemberWrite to return true, returned false")
+	}
+
+	// expecting user has Write role
+	if ok, err := database.IsMemberWrite(3, 1); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Errorf("Expected IsMemberWrite to return true, returned false")
+	}
+
+	// expecting user is NOT Write (Read role)
+	if ok, err := database.IsMemberWrite(1, 3); err != nil {
+		t.Error(err)
+	} else if ok {
+		t.Errorf("Expected IsMemberWrite to return false, returned true")
+	}
+}
+
 func TestDeleteMember(t *testing.T) {
 	Setup()
 	defer Teardown()
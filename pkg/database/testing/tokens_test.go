@@ -0,0 +1,79 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
+)
+
+func TestSaveToken(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	token := NewToken(1, "deploy", true)
+	if err := database.SaveToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-retrieve the token by value
+	saved, err := database.GetTokenValue(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.ID != token.ID {
+		t.Errorf("Exepected ID %d, got %d", token.ID, saved.ID)
+	}
+
+	if saved.UserID != 1 {
+		t.Errorf("Exepected UserID %d, got %d", 1, saved.UserID)
+	}
+
+	if saved.Name != "deploy" {
+		t.Errorf("Exepected Name %s, got %s", "deploy", saved.Name)
+	}
+
+	if !saved.ReadOnly {
+		t.Errorf("Exepected ReadOnly %v, got %v", true, saved.ReadOnly)
+	}
+}
+
+func TestListTokens(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	database.SaveToken(NewToken(1, "deploy", true))
+	database.SaveToken(NewToken(1, "cli", false))
+	database.SaveToken(NewToken(2, "cli", false))
+
+	tokens, err := database.ListTokens(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 2 {
+		t.Fatalf("Exepected %d tokens, got %d", 2, len(tokens))
+	}
+
+	// tokens are sorted by name
+	if tokens[0].Name != "cli" {
+		t.Errorf("Exepected Name %s, got %s", "cli", tokens[0].Name)
+	}
+}
+
+func TestDeleteToken(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	token := NewToken(1, "deploy", false)
+	database.SaveToken(token)
+
+	if err := database.DeleteToken(token.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.GetTokenValue(token.Token); err == nil {
+		t.Errorf("Expected token to be deleted")
+	}
+}
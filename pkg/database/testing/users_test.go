@@ -47,6 +47,24 @@ func TestGetUser(t *testing.T) {
 
 // TestGetUseEmail tests the ability to retrieve a User
 // from the database by Email address.
+func TestGetUserToken(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	u, err := database.GetUserToken("456")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if u.ID != 2 {
+		t.Errorf("Exepected ID %d, got %d", 2, u.ID)
+	}
+
+	if u.Email != "cavepig@gmail.com" {
+		t.Errorf("Exepected Email %s, got %s", "cavepig@gmail.com", u.Email)
+	}
+}
+
 func TestGetUserEmail(t *testing.T) {
 	Setup()
 	defer Teardown()
@@ -81,6 +99,32 @@ func TestGetUserEmail(t *testing.T) {
 	}
 }
 
+// TestGetUserGithubLogin tests the ability to retrieve
+// a User from the database by GitHub login.
+func TestGetUserGithubLogin(t *testing.T) {
+	Setup()
+	defer Teardown()
+
+	u, _ := database.GetUser(2)
+	u.GithubLogin = "cavepig"
+	if err := database.SaveUser(u); err != nil {
+		t.Error(err)
+	}
+
+	u, err := database.GetUserGithubLogin("cavepig")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if u.ID != 2 {
+		t.Errorf("Exepected ID %d, got %d", 2, u.ID)
+	}
+
+	if _, err := database.GetUserGithubLogin("bradrydzewski"); err == nil {
+		t.Errorf("Exepected error for unknown GitHub login")
+	}
+}
+
 // TestUpdateUser tests the ability to updatee an
 // existing User in the database.
 func TestUpdateUser(t *testing.T) {
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"time"
+
+	. "github.com/drone/drone/pkg/model"
+	"github.com/russross/meddler"
+)
+
+// Name of the Token table in the database
+const tokenTable = "tokens"
+
+// SQL Queries to retrieve a list of all tokens belonging to a user.
+const tokenStmt = `
+SELECT id, user_id, name, token, read_only, created, updated
+FROM tokens
+WHERE user_id = ?
+ORDER BY name ASC
+`
+
+// SQL Queries to retrieve a token by id.
+const tokenFindStmt = `
+SELECT id, user_id, name, token, read_only, created, updated
+FROM tokens
+WHERE id = ?
+`
+
+// SQL Queries to retrieve a token by its value.
+const tokenFindValueStmt = `
+SELECT id, user_id, name, token, read_only, created, updated
+FROM tokens
+WHERE token = ?
+`
+
+// SQL Queries to delete a token.
+const tokenDeleteStmt = `
+DELETE FROM tokens WHERE id = ?
+`
+
+// Returns the Token with the given ID.
+func GetToken(id int64) (*Token, error) {
+	token := Token{}
+	err := meddler.QueryRow(db, &token, tokenFindStmt, id)
+	return &token, err
+}
+
+// Returns the Token with the given value.
+func GetTokenValue(value string) (*Token, error) {
+	token := Token{}
+	err := meddler.QueryRow(db, &token, tokenFindValueStmt, value)
+	return &token, err
+}
+
+// Saves a Token.
+func SaveToken(token *Token) error {
+	if token.ID == 0 {
+		token.Created = time.Now().UTC()
+	}
+	token.Updated = time.Now().UTC()
+	return meddler.Save(db, tokenTable, token)
+}
+
+// Deletes an existing Token.
+func DeleteToken(id int64) error {
+	_, err := db.Exec(tokenDeleteStmt, id)
+	return err
+}
+
+// Returns a list of all Tokens belonging
+// to the specified User ID.
+func ListTokens(user int64) ([]*Token, error) {
+	var tokens []*Token
+	err := meddler.QueryAll(db, &tokens, tokenStmt, user)
+	return tokens, err
+}
@@ -24,6 +24,21 @@ github_login, github_token, bitbucket_login, bitbucket_token, bitbucket_secret
 FROM users WHERE email = ?
 `
 
+// SQL Queries to retrieve a user by their api token
+const userFindTokenStmt = `
+SELECT id, email, password, token, name, gravatar, created, updated, admin,
+github_login, github_token, bitbucket_login, bitbucket_token, bitbucket_secret
+FROM users WHERE token = ?
+`
+
+// SQL Queries to retrieve a user by their github login
+const userFindGithubLoginStmt = `
+SELECT id, email, password, token, name, gravatar, created, updated, admin,
+github_login, github_token, bitbucket_login, bitbucket_token, bitbucket_secret
+FROM users WHERE github_login = ?
+LIMIT 1
+`
+
 // SQL Queries to retrieve a list of all users
 const userStmt = `
 SELECT id, email, password, token, name, gravatar, created, updated, admin,
@@ -46,6 +61,20 @@ func GetUserEmail(email string) (*User, error) {
 	return &user, err
 }
 
+// Returns the User with the given api token.
+func GetUserToken(token string) (*User, error) {
+	user := User{}
+	err := meddler.QueryRow(db, &user, userFindTokenStmt, token)
+	return &user, err
+}
+
+// Returns the User with the given GitHub login.
+func GetUserGithubLogin(login string) (*User, error) {
+	user := User{}
+	err := meddler.QueryRow(db, &user, userFindGithubLoginStmt, login)
+	return &user, err
+}
+
 // Returns the User Password Hash for the given
 // email address.
 func GetPassEmail(email string) ([]byte, error) {
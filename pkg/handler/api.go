@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
+)
+
+// Returns a list of Repositories owned by the
+// authenticated User.
+func APIUserRepos(w http.ResponseWriter, r *http.Request, u *User) error {
+	repos, err := database.ListRepos(u.ID)
+	if err != nil {
+		return err
+	}
+
+	return RenderJson(w, repos)
+}
+
+// Returns a list of Repositories owned by the Team.
+// The authenticated User must be a member of the Team.
+func APITeamRepos(w http.ResponseWriter, r *http.Request, u *User) error {
+	team, err := database.GetTeamSlug(r.FormValue(":team"))
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	if member, _ := database.IsMember(u.ID, team.ID); !member {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	repos, err := database.ListReposTeam(team.ID)
+	if err != nil {
+		return err
+	}
+
+	return RenderJson(w, repos)
+}
+
+// Returns the Repository.
+func APIRepo(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	return RenderJson(w, repo)
+}
+
+// Activates the Repository, enabling build hooks.
+func APIRepoActivate(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	return apiRepoDisable(w, u, repo, false)
+}
+
+// Deactivates the Repository, disabling build hooks.
+func APIRepoDeactivate(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	return apiRepoDisable(w, u, repo, true)
+}
+
+// Returns a list of recent Commits for the Repository
+// and branch. If no branch is provided the default
+// branch is used.
+func APICommits(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	branch := r.FormValue("branch")
+	if len(branch) == 0 {
+		branch = repo.DefaultBranch()
+	}
+
+	commits, err := database.ListCommits(repo.ID, branch)
+	if err != nil {
+		return err
+	}
+
+	return RenderJson(w, commits)
+}
+
+// Returns the Commit, including the list of Builds.
+func APICommit(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	commit, err := database.GetCommitHash(r.FormValue(":commit"), repo.ID)
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	builds, err := database.ListBuilds(commit.ID)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		*Commit
+		Builds []*Build `json:"builds"`
+	}{commit, builds}
+
+	return RenderJson(w, &data)
+}
+
+// Returns the Build, including the status and duration.
+func APIBuild(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	build, err := apiGetBuild(r, repo)
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	return RenderJson(w, build)
+}
+
+// Returns the stdout / stderr for the Build.
+func APIBuildLog(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	build, err := apiGetBuild(r, repo)
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	return RenderText(w, build.Stdout, http.StatusOK)
+}
+
+// helper function that retrieves the Build based
+// on the URL parameters.
+func apiGetBuild(r *http.Request, repo *Repo) (*Build, error) {
+	commit, err := database.GetCommitHash(r.FormValue(":commit"), repo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.GetBuildSlug(r.FormValue(":label"), commit.ID)
+}
+
+// helper function that enables or disables build hooks
+// for the Repository. The User must own the Repository
+// or be an administrator of the Team that owns it.
+func apiRepoDisable(w http.ResponseWriter, u *User, repo *Repo, disabled bool) error {
+	if u == nil {
+		return RenderText(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+	if u.ID != repo.UserID {
+		if admin, _ := database.IsMemberAdmin(u.ID, repo.TeamID); !admin {
+			return RenderText(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+	}
+
+	repo.Disabled = disabled
+	if err := database.SaveRepo(repo); err != nil {
+		return err
+	}
+
+	return RenderJson(w, repo)
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
+	"github.com/drone/go-bitbucket/bitbucket"
+	"github.com/drone/go-bitbucket/oauth1"
 	"github.com/drone/go-github/github"
 	"github.com/drone/go-github/oauth2"
 )
@@ -94,3 +96,66 @@ func LinkGithub(w http.ResponseWriter, r *http.Request, u *User) error {
 	http.Redirect(w, r, "/new/github.com", http.StatusSeeOther)
 	return nil
 }
+
+func LinkBitbucket(w http.ResponseWriter, r *http.Request, u *User) error {
+
+	// get settings from database
+	settings := database.SettingsMust()
+
+	// bitbucket OAuth1.0a consumer
+	consumer := newBitbucketConsumer()
+
+	// get the OAuth verifier
+	verifier := r.FormValue("oauth_verifier")
+	if len(verifier) == 0 {
+		// request a temporary token, and redirect the
+		// user to Bitbucket to authorize the token
+		requestToken, err := consumer.RequestToken()
+		if err != nil {
+			log.Println("Error requesting Bitbucket request token")
+			return err
+		}
+
+		// the request token is needed to exchange the
+		// token once the user is redirected back
+		SetCookie(w, r, "bitbucket_token", requestToken.Encode())
+		link, err := consumer.AuthorizeRedirect(requestToken)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return nil
+	}
+
+	// exchange the request token for an access token
+	requestToken, err := oauth1.ParseRequestTokenStr(GetCookie(r, "bitbucket_token"))
+	DelCookie(w, r, "bitbucket_token")
+	if err != nil {
+		return err
+	}
+	accessToken, err := consumer.AuthorizeToken(requestToken, verifier)
+	if err != nil {
+		log.Println("Error granting Bitbucket authorization token")
+		return err
+	}
+
+	// get the user information
+	client := bitbucket.New(settings.BitbucketKey, settings.BitbucketSecret, accessToken.Token(), accessToken.Secret())
+	account, err := client.Users.Current()
+	if err != nil {
+		log.Println("Error retrieving currently authenticated Bitbucket user")
+		return err
+	}
+
+	// save the bitbucket token to the user account
+	u.BitbucketToken = accessToken.Token()
+	u.BitbucketSecret = accessToken.Secret()
+	u.BitbucketLogin = account.User.Username
+	if err := database.SaveUser(u); err != nil {
+		log.Println("Error persisting user's Bitbucket auth token to the database")
+		return err
+	}
+
+	http.Redirect(w, r, "/new/bitbucket.org", http.StatusSeeOther)
+	return nil
+}
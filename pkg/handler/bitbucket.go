@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
+	"github.com/drone/go-bitbucket/bitbucket"
+	"github.com/drone/go-bitbucket/oauth1"
+)
+
+// newBitbucketClient is a helper function that creates a
+// Bitbucket client authenticated as the given user.
+func newBitbucketClient(user *User) *bitbucket.Client {
+	settings := database.SettingsMust()
+	return bitbucket.New(settings.BitbucketKey, settings.BitbucketSecret, user.BitbucketToken, user.BitbucketSecret)
+}
+
+// newBitbucketConsumer is a helper function that creates the
+// OAuth1.0a consumer used to link a Bitbucket account, and to
+// sign the requests that aren't supported by the client.
+func newBitbucketConsumer() *oauth1.Consumer {
+	settings := database.SettingsMust()
+	return &oauth1.Consumer{
+		RequestTokenURL:  "https://bitbucket.org/api/1.0/oauth/request_token/",
+		AuthorizationURL: "https://bitbucket.org/!api/1.0/oauth/authenticate",
+		AccessTokenURL:   "https://bitbucket.org/api/1.0/oauth/access_token/",
+		CallbackURL:      settings.URL().String() + "/auth/login/bitbucket",
+		ConsumerKey:      settings.BitbucketKey,
+		ConsumerSecret:   settings.BitbucketSecret,
+	}
+}
+
+// bitbucketChangeset represents the changeset details
+// returned by the Bitbucket changesets API.
+type bitbucketChangeset struct {
+	RawNode      string `json:"raw_node"`
+	RawAuthor    string `json:"raw_author"`
+	Message      string `json:"message"`
+	UtcTimestamp string `json:"utctimestamp"`
+}
+
+// getBitbucketCommit is a helper function that will retrieve
+// the commit details for the given branch, tag or hash from
+// Bitbucket.
+// see https://confluence.atlassian.com/display/BITBUCKET/changesets+Resource
+func getBitbucketCommit(user *User, repo *Repo, ref string) (*bitbucketChangeset, error) {
+	token := oauth1.NewAccessToken(user.BitbucketToken, user.BitbucketSecret, nil)
+	url := fmt.Sprintf("https://api.bitbucket.org/1.0/repositories/%s/%s/changesets/%s", repo.Owner, repo.Name, ref)
+	resp, err := newBitbucketConsumer().Get(url, nil, token)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find commit %s in repository %s/%s", ref, repo.Owner, repo.Name)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to find commit %s in repository %s/%s", ref, repo.Owner, repo.Name)
+	}
+
+	changeset := bitbucketChangeset{}
+	if err := json.NewDecoder(resp.Body).Decode(&changeset); err != nil {
+		return nil, err
+	}
+	return &changeset, nil
+}
+
+// fetchBitbucketFile is a helper function that will retrieve the
+// contents of the file at the given commit hash from Bitbucket. The
+// returned error message is suitable for display to the user.
+func fetchBitbucketFile(user *User, repo *Repo, path, hash string) ([]byte, error) {
+	source, err := newBitbucketClient(user).Sources.Find(repo.Owner, repo.Name, hash, path)
+	if err != nil {
+		return nil, fmt.Errorf("No %s was found in this repository.  You need to add one.\n", path)
+	}
+	return []byte(source.Data), nil
+}
+
+// parseBitbucketEmail is a helper function that extracts the
+// email address from a raw author string, for example:
+// Brad Rydzewski <brad.rydzewski@gmail.com>
+func parseBitbucketEmail(raw string) string {
+	start := strings.LastIndex(raw, "<")
+	end := strings.LastIndex(raw, ">")
+	if start == -1 || end < start {
+		return ""
+	}
+	return raw[start+1 : end]
+}
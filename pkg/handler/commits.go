@@ -27,6 +27,13 @@ func CommitShow(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) err
 		return err
 	}
 
+	// a commit that is waiting for approval, or that was
+	// skipped, has no builds, so we display an empty build
+	// with the commit status.
+	if len(builds) == 0 {
+		builds = append(builds, &Build{Slug: "1", Status: commit.Status})
+	}
+
 	data := struct {
 		User   *User
 		Repo   *Repo
@@ -34,13 +41,24 @@ func CommitShow(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) err
 		Build  *Build
 		Builds []*Build
 		Token  string
-	}{u, repo, commit, builds[0], builds, ""}
+		Admin  bool
+		Writer bool
+	}{u, repo, commit, builds[0], builds, "", false, false}
+
+	// the role of the user determines which actions
+	// are displayed, such as restarting the build.
+	if u != nil {
+		data.Admin = isRepoAdmin(u, repo)
+		data.Writer = isRepoWriter(u, repo)
+	}
 
 	// get the specific build requested by the user. instead
 	// of a database round trip, we can just loop through the
-	// list and extract the requested build.
+	// list and extract the requested build. if no build is
+	// requested we display the first build of the most
+	// recent attempt.
 	for _, b := range builds {
-		if b.Slug == labl {
+		if b.Slug == labl || (len(labl) == 0 && b.Attempt == commit.Attempts) {
 			data.Build = b
 			break
 		}
@@ -49,7 +67,7 @@ func CommitShow(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) err
 	// generate a token to connect with the websocket
 	// handler and stream output, if the build is running.
 	data.Token = channel.Token(fmt.Sprintf(
-		"%s/%s/%s/commit/%s/builds/%s", repo.Host, repo.Owner, repo.Name, commit.Hash, builds[0].Slug))
+		"%s/%s/%s/commit/%s/builds/%s", repo.Host, repo.Owner, repo.Name, commit.Hash, data.Build.Slug))
 
 	// render the repository template.
 	return RenderTemplate(w, "repo_commit.html", &data)
@@ -0,0 +1,394 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/drone/drone/pkg/build/git"
+	buildrepo "github.com/drone/drone/pkg/build/repo"
+	. "github.com/drone/drone/pkg/model"
+)
+
+// hexHash matches an abbreviated or full Git or Mercurial
+// commit hash.
+var hexHash = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// svnRevision matches a Subversion revision number.
+var svnRevision = regexp.MustCompile(`^[0-9]+$`)
+
+// refChars matches the characters allowed in a branch
+// or tag name.
+var refChars = regexp.MustCompile(`^[A-Za-z0-9._/+-]+$`)
+
+// isValidRef returns true if the branch or tag name is
+// valid, and can't be mistaken for a command line option.
+func isValidRef(ref string) bool {
+	switch {
+	case strings.HasPrefix(ref, "-"),
+		strings.HasPrefix(ref, "/"),
+		strings.HasSuffix(ref, "/"),
+		strings.HasSuffix(ref, "."),
+		strings.HasSuffix(ref, ".lock"),
+		strings.Contains(ref, ".."),
+		strings.Contains(ref, "//"):
+		return false
+	}
+	return refChars.MatchString(ref)
+}
+
+// isValidHash returns true if the hash is a valid commit
+// hash, or revision number, for the repository.
+func isValidHash(repo *Repo, hash string) bool {
+	if repo.SCM == ScmSvn {
+		return svnRevision.MatchString(hash)
+	}
+	return hexHash.MatchString(hash)
+}
+
+// customLocks serializes fetches into the same cached
+// repository, since hooks for the same repository may
+// be received at the same time.
+var customLocks = struct {
+	sync.Mutex
+	paths map[string]*sync.Mutex
+}{paths: map[string]*sync.Mutex{}}
+
+// customLock returns the lock for the cached repository
+// at the given path.
+func customLock(path string) *sync.Mutex {
+	customLocks.Lock()
+	defer customLocks.Unlock()
+
+	lock, ok := customLocks.paths[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		customLocks.paths[path] = lock
+	}
+	return lock
+}
+
+// customRepoDir returns the directory on the host machine
+// where the commits of the Git or Mercurial repository are
+// fetched.
+func customRepoDir(repo *Repo) string {
+	tmp := os.Getenv("DRONE_TMP")
+	if len(tmp) == 0 {
+		tmp = "/tmp/drone"
+	}
+	return filepath.Join(tmp, "custom", filepath.Clean("/"+repo.Slug))
+}
+
+// execCustomRepo is a helper function that executes the git, hg
+// or svn command for the repository, using the repository deploy
+// key. Git and Mercurial commands are executed against the cached
+// repository, see fetchCustomCommit and fetchCustomHg, while
+// Subversion commands are executed against the remote repository.
+func execCustomRepo(repo *Repo, args ...string) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// the wrapper is used as the GIT_SSH and SVN_SSH
+	// command, so that the deploy key is used.
+	ssh, err := git.WriteSSH(dir, []byte(repo.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	switch repo.SCM {
+	case ScmHg:
+		args = append([]string{"--config", "ui.ssh=" + ssh, "--repository", customRepoDir(repo)}, args...)
+	case ScmSvn:
+		args = append([]string{"--non-interactive"}, args...)
+	default:
+		args = append([]string{"--git-dir", customRepoDir(repo)}, args...)
+	}
+
+	cmd := exec.Command(repo.SCM, args...)
+	if len(repo.SCM) == 0 {
+		cmd = exec.Command(ScmGit, args...)
+	}
+	cmd.Env = append(os.Environ(), "GIT_SSH="+ssh, "SVN_SSH="+ssh)
+	return cmd.Output()
+}
+
+// fetchCustomCommit is a helper function that fetches the
+// commit for the branch, tag or sha from the Git repository
+// into the cached repository on the host machine, and returns
+// the full hash of the commit. Only the single commit is
+// fetched, unless the remote repository doesn't allow a
+// commit to be fetched by its hash, in which case the
+// branch is fetched instead.
+func fetchCustomCommit(repo *Repo, branch, ref string) (string, error) {
+	if !isValidRef(branch) || !isValidRef(ref) {
+		return "", fmt.Errorf("Invalid branch %s or commit %s", branch, ref)
+	}
+
+	dir := customRepoDir(repo)
+	lock := customLock(dir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// if the cached repository does not exist, or was
+	// not completely initialized, then we create it.
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		os.RemoveAll(dir)
+		if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+			return "", err
+		}
+		if _, err := execCustomRepo(repo, "init", "--bare", "--quiet"); err != nil {
+			return "", err
+		}
+	}
+
+	// a branch or tag name is resolved by the remote
+	// repository, and the fetched commit is verified.
+	if !hexHash.MatchString(ref) {
+		if _, err := execCustomRepo(repo, "fetch", "--quiet", "--depth=1", "--", repo.URL, ref); err != nil {
+			return "", err
+		}
+		return verifyCustomCommit(repo, "FETCH_HEAD")
+	}
+
+	// the commit may have been fetched already, for
+	// example to read the commit details.
+	if hash, err := verifyCustomCommit(repo, ref); err == nil {
+		return hash, nil
+	}
+	if _, err := execCustomRepo(repo, "fetch", "--quiet", "--depth=1", "--", repo.URL, ref); err != nil {
+		if _, err := execCustomRepo(repo, "fetch", "--quiet", "--", repo.URL, branch); err != nil {
+			return "", err
+		}
+	}
+	return verifyCustomCommit(repo, ref)
+}
+
+// fetchCustomHg is a helper function that pulls the changesets
+// of the Mercurial repository into the cached repository on the
+// host machine, unless the hash is already present. A branch name
+// is always pulled, so that its head is up to date.
+func fetchCustomHg(repo *Repo, rev string) error {
+	if !isValidRef(rev) {
+		return fmt.Errorf("Invalid commit %s", rev)
+	}
+
+	dir := customRepoDir(repo)
+	lock := customLock(dir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// if the cached repository does not exist, or was
+	// not completely initialized, then we create it.
+	if _, err := os.Stat(filepath.Join(dir, ".hg", "requires")); err != nil {
+		os.RemoveAll(dir)
+		if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+			return err
+		}
+		if out, err := exec.Command(ScmHg, "init", "--", dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("Unable to create repository %s.\n%s", dir, out)
+		}
+	}
+
+	// the changeset may have been pulled already, for
+	// example to read the commit details.
+	if hexHash.MatchString(rev) {
+		if _, err := execCustomRepo(repo, "log", "--limit", "1", "--rev", rev); err == nil {
+			return nil
+		}
+	}
+	_, err := execCustomRepo(repo, "pull", "--quiet", "--", repo.URL)
+	return err
+}
+
+// verifyCustomCommit is a helper function that verifies the
+// ref names a commit in the cached Git repository, and
+// returns the full hash of the commit. The ref must be
+// validated using isValidRef, so that it isn't parsed as
+// an option.
+func verifyCustomCommit(repo *Repo, ref string) (string, error) {
+	out, err := execCustomRepo(repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// svnLog represents the output of the svn log --xml command.
+type svnLog struct {
+	Entries []struct {
+		Revision string `xml:"revision,attr"`
+		Author   string `xml:"author"`
+		Date     string `xml:"date"`
+		Msg      string `xml:"msg"`
+	} `xml:"logentry"`
+}
+
+// getCustomCommit is a helper function that will retrieve the
+// commit details for the given branch, tag or sha from the
+// repository. If the ref is the branch name, the head commit
+// of the branch is returned.
+func getCustomCommit(repo *Repo, branch, ref string) (*Commit, error) {
+	if !isValidRef(branch) || !isValidRef(ref) {
+		return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+	}
+
+	var lines []string
+	switch repo.SCM {
+	case ScmSvn:
+		// the subversion revision defaults to the
+		// head revision of the branch.
+		rev := ref
+		if rev == branch {
+			rev = "HEAD"
+		}
+		out, err := execCustomRepo(repo, "log", "--xml", "--limit", "1", "--revision", rev+":1", "--", svnURL(repo, branch))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		log := svnLog{}
+		if err := xml.Unmarshal(out, &log); err != nil || len(log.Entries) == 0 {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		entry := log.Entries[0]
+		lines = []string{entry.Revision, entry.Author, entry.Date, entry.Msg}
+	case ScmHg:
+		if err := fetchCustomHg(repo, ref); err != nil {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		out, err := execCustomRepo(repo, "log", "--limit", "1", "--rev", ref, "--template", "{node}\n{author|email}\n{date|isodate}\n{desc}")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		lines = strings.SplitN(string(out), "\n", 4)
+	default:
+		hash, err := fetchCustomCommit(repo, branch, ref)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		out, err := execCustomRepo(repo, "log", "-1", "--date=iso", "--format=%H%n%ae%n%ad%n%B", hash, "--")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+		}
+		lines = strings.SplitN(string(out), "\n", 4)
+	}
+
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("Unable to find commit %s in repository %s", ref, repo.URL)
+	}
+
+	commit := &Commit{}
+	commit.Hash = lines[0]
+	commit.Timestamp = lines[2]
+	commit.Message = strings.TrimSpace(lines[3])
+	commit.SetAuthor(lines[1])
+	return commit, nil
+}
+
+// fetchCustomFile is a helper function that will retrieve the
+// contents of the file at the given commit from the repository.
+// The returned error message is suitable for display to the user.
+func fetchCustomFile(repo *Repo, path string, commit *Commit) ([]byte, error) {
+	var raw []byte
+	var err error
+	switch {
+	case !isValidRef(commit.Branch) || !isValidHash(repo, commit.Hash):
+		err = fmt.Errorf("Invalid branch %s or commit %s", commit.Branch, commit.Hash)
+	case repo.SCM == ScmSvn:
+		raw, err = execCustomRepo(repo, "cat", "--revision", commit.Hash, "--", svnURL(repo, commit.Branch)+"/"+path)
+	case repo.SCM == ScmHg:
+		if err = fetchCustomHg(repo, commit.Hash); err == nil {
+			raw, err = execCustomRepo(repo, "cat", "--rev", commit.Hash, "--", path)
+		}
+	default:
+		var hash string
+		hash, err = fetchCustomCommit(repo, commit.Branch, commit.Hash)
+		if err == nil {
+			raw, err = execCustomRepo(repo, "show", hash+":"+path)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("No %s was found in this repository.  You need to add one.\n", path)
+	}
+	return raw, nil
+}
+
+// svnURL is a helper function that returns the URL
+// of the branch in the Subversion repository.
+func svnURL(repo *Repo, branch string) string {
+	r := buildrepo.Repo{Branch: branch}
+	return strings.TrimRight(repo.URL, "/") + "/" + r.SvnPath()
+}
+
+// cloneSchemes lists the URL schemes that may be used to
+// clone a repository of each source control system. Local
+// paths and file URLs are not allowed, since the repository
+// is fetched on the host machine.
+var cloneSchemes = map[string][]string{
+	ScmGit: {"ssh", "https", "git"},
+	ScmHg:  {"ssh", "https"},
+	ScmSvn: {"svn", "svn+ssh", "https"},
+}
+
+// scpURL matches the scp-like syntax of a Git clone URL,
+// for example git@git.example.com:drone/drone.git
+var scpURL = regexp.MustCompile(`^([A-Za-z0-9_][A-Za-z0-9._-]*@)?[A-Za-z0-9][A-Za-z0-9.-]*:.+$`)
+
+// isValidCloneURL returns true if the clone URL uses one of
+// the allowed schemes, and can't be mistaken for a command
+// line option or a local path.
+func isValidCloneURL(scm, rawurl string) bool {
+	if strings.HasPrefix(rawurl, "-") || strings.ContainsAny(rawurl, " \t\r\n") {
+		return false
+	}
+
+	// scp-like syntax is only supported by git, and
+	// has no scheme.
+	if !strings.Contains(rawurl, "://") {
+		return scm == ScmGit && scpURL.MatchString(rawurl)
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil || len(u.Host) == 0 || strings.HasPrefix(u.Host, "-") {
+		return false
+	}
+	if u.User != nil && strings.HasPrefix(u.User.Username(), "-") {
+		return false
+	}
+	for _, scheme := range cloneSchemes[scm] {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCloneURL is a helper function that extracts the owner
+// and name of the repository from a git clone URL, for example:
+// git@git.example.com:drone/drone.git
+func parseCloneURL(url string) (owner, name string) {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+
+	// scp-like syntax uses a colon to separate
+	// the host from the path.
+	if i := strings.Index(url, "://"); i != -1 {
+		url = url[i+3:]
+	} else if i := strings.Index(url, ":"); i != -1 {
+		url = url[:i] + "/" + url[i+1:]
+	}
+
+	parts := strings.Split(url, "/")
+	if len(parts) < 3 {
+		return "", ""
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
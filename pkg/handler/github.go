@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
+	"github.com/drone/go-github/github"
+)
+
+// getGitHubCommit is a helper function that will retrieve the
+// commit details for the given branch, tag or sha from GitHub.
+func getGitHubCommit(user *User, repo *Repo, ref string) (*github.RepoCommit, error) {
+	client := newGitHubClient(user)
+	commit, err := client.Commits.Find(repo.Owner, repo.Name, ref)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find commit %s in repository %s/%s", ref, repo.Owner, repo.Name)
+	}
+	return commit, nil
+}
+
+// fetchGitHubFile is a helper function that will retrieve the
+// contents of the file at the given commit hash from GitHub. The
+// returned error message is suitable for display to the user.
+func fetchGitHubFile(user *User, repo *Repo, path, hash string) ([]byte, error) {
+	// get the file from GitHub
+	client := newGitHubClient(user)
+	content, err := client.Contents.FindRef(repo.Owner, repo.Name, path, hash)
+	if err != nil {
+		return nil, fmt.Errorf("No %s was found in this repository.  You need to add one.\n", path)
+	}
+
+	// decode the content.  Note: Not sure this will ever happen...it basically means a GitHub API issue
+	raw, err := content.DecodeContent()
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode the yaml from GitHub.  Check that your %s is a valid yaml file.\n", path)
+	}
+
+	return raw, nil
+}
+
+// createGitHubHook is a helper function that will add a hook to
+// the GitHub repository, or update the existing hook with the same
+// URL. GitHub signs the hook payload using the repository secret.
+func createGitHubHook(user *User, repo *Repo, link string) error {
+	client := newGitHubClient(user)
+	config := map[string]string{
+		"url":          link,
+		"content_type": "form",
+		"secret":       repo.HookSecret,
+	}
+
+	hook, err := client.Hooks.FindUrl(repo.Owner, repo.Name, link)
+	switch {
+	case err == github.ErrNotFound:
+		return postGitHubHook(user, repo, config)
+	case err != nil:
+		return err
+	}
+
+	hook.Active = true
+	hook.Events = gitHubHookEvents
+	hook.Config = config
+	_, err = client.Hooks.Update(repo.Owner, repo.Name, hook)
+	return err
+}
+
+// gitHubHookEvents are the events that trigger the hook.
+var gitHubHookEvents = []string{"push", "pull_request"}
+
+// postGitHubHook is a helper function that will add a hook to the
+// GitHub repository. The hook is created with the secret in a single
+// request, since the client creates the hook without a secret, and
+// GitHub would send unsigned payloads until the hook is updated.
+// see http://developer.github.com/v3/repos/hooks/#create-a-hook
+func postGitHubHook(user *User, repo *Repo, config map[string]string) error {
+	in := struct {
+		Name   string            `json:"name"`
+		Active bool              `json:"active"`
+		Events []string          `json:"events"`
+		Config map[string]string `json:"config"`
+	}{"web", true, gitHubHookEvents, config}
+	body, err := json.Marshal(&in)
+	if err != nil {
+		return err
+	}
+
+	settings := database.SettingsMust()
+	url := fmt.Sprintf("%s/repos/%s/%s/hooks", settings.GitHubApiUrl, repo.Owner, repo.Name)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "token "+user.GithubToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Unable to create the hook for repository %s/%s. %s", repo.Owner, repo.Name, resp.Status)
+	}
+	return nil
+}
+
+// newGitHubClient is a helper function that returns a GitHub
+// client for the user, using the GitHub (or GitHub Enterprise)
+// API URL from the settings.
+func newGitHubClient(user *User) *github.Client {
+	settings := database.SettingsMust()
+	client := github.New(user.GithubToken)
+	client.ApiUrl = settings.GitHubApiUrl
+	return client
+}
+
+// verifyGitHubSignature is a helper function that returns true
+// if the X-Hub-Signature header is the HMAC hex digest of the
+// request body, computed using the repository secret.
+// see http://developer.github.com/v3/repos/hooks/#create-a-hook
+func verifyGitHubSignature(secret, signature string, body []byte) bool {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
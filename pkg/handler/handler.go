@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
@@ -142,9 +143,113 @@ func (h RepoAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// The User must own the repository OR be a member
 	// of the Team that owns the repository.
-	if user.ID != repo.UserID {
-		if admin, _ := database.IsMemberAdmin(user.ID, repo.TeamID); admin == false {
-			RenderNotFound(w)
+	if !isRepoAdmin(user, repo) {
+		RenderNotFound(w)
+		return
+	}
+
+	if err = h(w, r, user, repo); err != nil {
+		log.Print(err)
+		RenderError(w, err, http.StatusBadRequest)
+	}
+}
+
+// RepoWriteHandler wraps the default http.HandlerFunc to include
+// the currently authenticated User and requested Repository
+// in the method signature, in addition to handling an error
+// as the return value. The User must have write access to
+// the Repository.
+type RepoWriteHandler func(w http.ResponseWriter, r *http.Request, user *User, repo *Repo) error
+
+func (h RepoWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := readUser(r)
+	if err != nil {
+		redirectLogin(w, r)
+		return
+	}
+
+	// repository name from the URL parameters
+	hostParam := r.FormValue(":host")
+	userParam := r.FormValue(":owner")
+	nameParam := r.FormValue(":name")
+	repoName := fmt.Sprintf("%s/%s/%s", hostParam, userParam, nameParam)
+
+	repo, err := database.GetRepoSlug(repoName)
+	if err != nil {
+		RenderNotFound(w)
+		return
+	}
+
+	// The User must own the repository OR be a member
+	// of the Team that owns the repository with write
+	// access.
+	if !isRepoWriter(user, repo) {
+		RenderNotFound(w)
+		return
+	}
+
+	if err = h(w, r, user, repo); err != nil {
+		log.Print(err)
+		RenderError(w, err, http.StatusBadRequest)
+	}
+}
+
+// APIHandler wraps the default http.HandlerFunc to include
+// the currently authenticated User in the method signature,
+// in addition to handling an error as the return value.
+type APIHandler func(w http.ResponseWriter, r *http.Request, user *User) error
+
+func (h APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := readUser(r)
+	if err != nil {
+		RenderText(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if err = h(w, r, user); err != nil {
+		log.Print(err)
+		RenderError(w, err, http.StatusBadRequest)
+	}
+}
+
+// APIRepoHandler wraps the default http.HandlerFunc to include
+// the currently authenticated User and requested Repository
+// in the method signature, in addition to handling an error as
+// the return value. The User is nil if the request is not
+// authenticated and the Repository is public.
+type APIRepoHandler func(w http.ResponseWriter, r *http.Request, user *User, repo *Repo) error
+
+func (h APIRepoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// repository name from the URL parameters
+	hostParam := r.FormValue(":host")
+	userParam := r.FormValue(":owner")
+	nameParam := r.FormValue(":name")
+	repoName := fmt.Sprintf("%s/%s/%s", hostParam, userParam, nameParam)
+
+	repo, err := database.GetRepoSlug(repoName)
+	if err != nil || repo == nil {
+		RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// retrieve the user from the database
+	user, err := readUser(r)
+
+	// if the user is not found, we can still
+	// serve the request assuming the repository
+	// is public.
+	switch {
+	case err != nil && repo.Private == true:
+		RenderText(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	case err != nil && repo.Private == false:
+		user = nil
+	case repo.Private == true && user.ID != repo.UserID:
+		// The User must own the repository OR be a member
+		// of the Team that owns the repository.
+		if member, _ := database.IsMember(user.ID, repo.TeamID); !member {
+			RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
 	}
@@ -156,11 +261,12 @@ func (h RepoAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // helper function that reads the currently authenticated
-// user from the given http.Request.
+// user from the given http.Request. The user is authenticated
+// using the session cookie or, if not present, an API token.
 func readUser(r *http.Request) (*User, error) {
 	username := GetCookie(r, "_sess")
 	if len(username) == 0 {
-		return nil, fmt.Errorf("No user session")
+		return readUserToken(r)
 	}
 
 	// get the user from the database
@@ -172,6 +278,40 @@ func readUser(r *http.Request) (*User, error) {
 	return user, nil
 }
 
+// helper function that reads the user authenticated by the
+// API token in the given http.Request. The token is provided
+// using the access_token parameter or the Authorization header,
+// and is either the User's token or a named Token.
+func readUserToken(r *http.Request) (*User, error) {
+	value := r.FormValue("access_token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "token ") {
+		value = auth[len("token "):]
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("No user session")
+	}
+
+	// get the user from the database
+	user, err := database.GetUserToken(value)
+	if err == nil && user.ID != 0 {
+		return user, nil
+	}
+
+	// else check for a named token
+	token, err := database.GetTokenValue(value)
+	if err != nil || token.ID == 0 {
+		return nil, fmt.Errorf("Invalid API token")
+	}
+
+	// read-only tokens can only be used for
+	// requests that do not modify data.
+	if token.ReadOnly && r.Method != "GET" && r.Method != "HEAD" {
+		return nil, fmt.Errorf("API token %s is read-only", token.Name)
+	}
+
+	return database.GetUser(token.UserID)
+}
+
 // helper function that retrieves the repository based
 // on the URL parameters
 func readRepo(r *http.Request) (*Repo, error) {
@@ -201,3 +341,25 @@ func renderBadRequest(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusBadRequest)
 	RenderTemplate(w, "500.amber", nil)
 }
+
+// isRepoAdmin is a helper function that returns true if the
+// user can administer the repository. The user must own the
+// repository or be an admin of the team.
+func isRepoAdmin(user *User, repo *Repo) bool {
+	if user.ID == repo.UserID {
+		return true
+	}
+	ok, _ := database.IsMemberAdmin(user.ID, repo.TeamID)
+	return ok
+}
+
+// isRepoWriter is a helper function that returns true if the
+// user has write access to the repository. The user must own
+// the repository or be a member of the team with write access.
+func isRepoWriter(user *User, repo *Repo) bool {
+	if user.ID == repo.UserID {
+		return true
+	}
+	ok, _ := database.IsMemberWrite(user.ID, repo.TeamID)
+	return ok
+}
@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/drone/drone/pkg/build/script"
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
 	"github.com/drone/drone/pkg/queue"
+	"github.com/drone/go-bitbucket/bitbucket"
 	"github.com/drone/go-github/github"
 )
 
@@ -26,6 +33,12 @@ func NewHookHandler(queue *queue.Queue) *HookHandler {
 // Processes a generic POST-RECEIVE hook and
 // attempts to trigger a build.
 func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
+	// verify the hook was signed using the repository
+	// secret, so that builds can't be forged.
+	if !verifyGitHubHook(r) {
+		return RenderText(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+
 	// handle github ping
 	if r.Header.Get("X-Github-Event") == "ping" {
 		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
@@ -51,9 +64,9 @@ func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// make sure this is being triggered because of a commit
-	// and not something like a tag deletion or whatever
-	if hook.IsTag() || hook.IsGithubPages() ||
-		hook.IsHead() == false || hook.IsDeleted() {
+	// or a tag, and not something like a branch deletion
+	if hook.IsGithubPages() || hook.IsDeleted() ||
+		(hook.IsHead() == false && hook.IsTag() == false) {
 		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 	}
 
@@ -66,6 +79,11 @@ func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
 		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 	}
 
+	// ignore the hook if builds are disabled
+	if repo.Disabled {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
 	// Get the user that owns the repository
 	user, err := database.GetUser(repo.UserID)
 	if err != nil {
@@ -99,6 +117,14 @@ func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
 	commit.Branch = hook.Branch()
 	commit.Hash = hook.Head.Id
 	commit.Status = "Pending"
+
+	// a tag is built in place of a branch, and the
+	// name of the tag is used as the branch name.
+	if hook.IsTag() {
+		commit.Tag = strings.TrimPrefix(hook.Ref, "refs/tags/")
+		commit.Branch = commit.Tag
+	}
+	commit.Attempts = 1
 	commit.Created = time.Now().UTC()
 
 	// extract the author and message from the commit
@@ -114,40 +140,79 @@ func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
 		commit.SetAuthor(hook.Commits[0].Author.Email)
 	}
 
-	// get the github settings from the database
-	settings := database.SettingsMust()
-
-	// get the drone.yml file from GitHub
-	client := github.New(user.GithubToken)
-	client.ApiUrl = settings.GitHubApiUrl
+	// store the files changed by the push, which are
+	// used to filter builds by path.
+	commit.Files = strings.Join(changedFiles(hook), "\n")
+
+	// a tag on a commit that was already built is attached
+	// to the existing commit, which is built again for the
+	// tag, so that the same commit isn't saved twice. The
+	// existing commit is left untouched unless it is built.
+	var existing *Commit
+	if hook.IsTag() {
+		existing, err = database.GetCommitHash(hook.Head.Id, repo.ID)
+		switch {
+		case err == sql.ErrNoRows:
+			// the tag is built as a new commit
+			existing = nil
+		case err != nil:
+			return RenderText(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		case existing.IsRunning():
+			return RenderText(w, fmt.Sprintf("Commit %s is already running", existing.HashShort()), http.StatusConflict)
+		}
+	}
 
-	content, err := client.Contents.FindRef(repo.Owner, repo.Name, ".drone.yml", commit.Hash)
-	if err != nil {
-		msg := "No .drone.yml was found in this repository.  You need to add one.\n"
-		if err := saveFailedBuild(commit, msg); err != nil {
+	// commits that instruct Drone to skip the build
+	// are saved, so that the user knows why a build
+	// wasn't triggered.
+	if isSkipCommit(commit.Message) {
+		if existing != nil {
+			return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+		}
+		if err := saveSkippedCommit(commit); err != nil {
 			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
-		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 	}
 
-	// decode the content.  Note: Not sure this will ever happen...it basically means a GitHub API issue
-	raw, err := content.DecodeContent()
+	// get the drone.yml file from GitHub and parse
+	// the build script
+	buildscript, err := fetchBuildScript(user, repo, commit)
 	if err != nil {
-		msg := "Could not decode the yaml from GitHub.  Check that your .drone.yml is a valid yaml file.\n"
-		if err := saveFailedBuild(commit, msg); err != nil {
+		if existing != nil {
+			return RenderText(w, err.Error(), http.StatusBadRequest)
+		}
+		if err := saveFailedBuild(commit, err.Error()); err != nil {
 			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
 		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 	}
 
-	// parse the build script
-	buildscript, err := script.ParseBuild(raw, repo.Params)
-	if err != nil {
-		msg := "Could not parse your .drone.yml file.  It needs to be a valid drone yaml file.\n\n" + err.Error() + "\n"
-		if err := saveFailedBuild(commit, msg); err != nil {
+	// ignore the hook if the branch is excluded
+	// by the build script
+	if !isBuildBranch(buildscript, commit) {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// commits that don't change any of the paths
+	// listed in the build script are skipped.
+	if !buildscript.Paths.Match(commit.FileList()) {
+		if existing != nil {
+			return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+		}
+		if err := saveSkippedCommit(commit); err != nil {
 			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
-		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// the existing commit is built again for the tag.
+	if existing != nil {
+		existing.Tag = commit.Tag
+		existing.Status = StatusEnqueue
+		existing.Attempts++
+		existing.Duration = 0
+		commit = existing
 	}
 
 	// save the commit to the database
@@ -155,22 +220,12 @@ func (h *HookHandler) Hook(w http.ResponseWriter, r *http.Request) error {
 		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 
-	// save the build to the database
-	build := &Build{}
-	build.Slug = "1" // TODO
-	build.CommitID = commit.ID
-	build.Created = time.Now().UTC()
-	build.Status = "Pending"
-	if err := database.SaveBuild(build); err != nil {
+	// save the builds to the database and add
+	// them to the build queue
+	if err := enqueue(h.queue, repo, commit, buildscript); err != nil {
 		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 
-	// notify websocket that a new build is pending
-	//realtime.CommitPending(repo.UserID, repo.TeamID, repo.ID, commit.ID, repo.Private)
-	//realtime.BuildPending(repo.UserID, repo.TeamID, repo.ID, commit.ID, build.ID, repo.Private)
-
-	h.queue.Add(&queue.BuildTask{Repo: repo, Commit: commit, Build: build, Script: buildscript}) //Push(repo, commit, build, buildscript)
-
 	// OK!
 	return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 }
@@ -181,9 +236,6 @@ func (h *HookHandler) PullRequestHook(w http.ResponseWriter, r *http.Request) {
 	// repository and commit details
 	payload := r.FormValue("payload")
 
-	println("GOT PR HOOK")
-	println(payload)
-
 	hook, err := github.ParsePullRequestHook([]byte(payload))
 	if err != nil {
 		RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -206,6 +258,12 @@ func (h *HookHandler) PullRequestHook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ignore the hook if pull request builds are disabled
+	if repo.Disabled || repo.DisabledPullRequest {
+		RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+		return
+	}
+
 	// Get the user that owns the repository
 	user, err := database.GetUser(repo.UserID)
 	if err != nil {
@@ -228,41 +286,57 @@ func (h *HookHandler) PullRequestHook(w http.ResponseWriter, r *http.Request) {
 	commit.Branch = hook.PullRequest.Head.Ref
 	commit.Hash = hook.PullRequest.Head.Sha
 	commit.Status = "Pending"
+	commit.Attempts = 1
 	commit.Created = time.Now().UTC()
 	commit.Gravatar = hook.PullRequest.User.GravatarId
 	commit.Author = hook.PullRequest.User.Login
 	commit.PullRequest = strconv.Itoa(hook.Number)
+	commit.BaseBranch = hook.PullRequest.Base.Ref
+	commit.BaseHash = hook.PullRequest.Base.Sha
 	commit.Message = hook.PullRequest.Title
-	// label := p.PullRequest.Head.Labe
 
-	// get the github settings from the database
-	settings := database.SettingsMust()
-
-	// get the drone.yml file from GitHub
-	client := github.New(user.GithubToken)
-	client.ApiUrl = settings.GitHubApiUrl
+	// pull requests that instruct Drone to skip the
+	// build are saved, so that the user knows why a
+	// build wasn't triggered.
+	if isSkipCommit(commit.Message) {
+		if err := saveSkippedCommit(commit); err != nil {
+			RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+		return
+	}
 
-	content, err := client.Contents.FindRef(repo.Owner, repo.Name, ".drone.yml", commit.Hash) // TODO should this really be the hash??
-	if err != nil {
-		println(err.Error())
-		RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// pull requests from untrusted authors are not built
+	// until they are approved by a user with write access,
+	// since the build could expose the repository secrets.
+	if !isTrustedPullRequest(repo, hook) {
+		commit.Untrusted = true
+		commit.Status = StatusApproval
+		if err := database.SaveCommit(commit); err != nil {
+			RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 		return
 	}
 
-	// decode the content
-	raw, err := content.DecodeContent()
+	// get the drone.yml file from GitHub and parse
+	// the build script
+	buildscript, err := fetchBuildScript(user, repo, commit)
 	if err != nil {
+		if err := saveFailedBuild(commit, err.Error()); err != nil {
+			RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
 		RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	// parse the build script
-	buildscript, err := script.ParseBuild(raw, repo.Params)
-	if err != nil {
-		// TODO if the YAML is invalid we should create a commit record
-		// with an ERROR status so that the user knows why a build wasn't
-		// triggered in the system
-		RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// ignore the hook if the base branch is excluded
+	// by the build script
+	if !isBuildBranch(buildscript, commit) {
+		RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 		return
 	}
 
@@ -272,25 +346,465 @@ func (h *HookHandler) PullRequestHook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// save the build to the database
-	build := &Build{}
-	build.Slug = "1" // TODO
-	build.CommitID = commit.ID
-	build.Created = time.Now().UTC()
-	build.Status = "Pending"
-	if err := database.SaveBuild(build); err != nil {
+	// save the builds to the database and add
+	// them to the build queue
+	if err := enqueue(h.queue, repo, commit, buildscript); err != nil {
 		RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	// notify websocket that a new build is pending
-	// TODO we should, for consistency, just put this inside Queue.Add()
-	h.queue.Add(&queue.BuildTask{Repo: repo, Commit: commit, Build: build, Script: buildscript})
-
 	// OK!
 	RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 }
 
+// Processes a Bitbucket POST service hook and
+// attempts to trigger a build.
+func (h *HookHandler) HookBitbucket(w http.ResponseWriter, r *http.Request) error {
+	// get the repo from the URL
+	repoId := r.FormValue("id")
+
+	// get the repo from the database, return error if not found
+	repo, err := database.GetRepoSlug(repoId)
+	if err != nil || repo.Host != HostBitbucket {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	// verify the hook was sent to the URL that includes
+	// the repository secret, so that builds can't be forged.
+	if !verifyBitbucketHook(r, repo) {
+		return RenderText(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+
+	// get the payload of the message
+	// this should contain a json representation of the
+	// repository and commit details
+	payload := r.FormValue("payload")
+
+	// parse the bitbucket Hook payload
+	hook, err := bitbucket.ParseHook([]byte(payload))
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	// make sure this is being triggered because of a commit
+	// pushed to a branch, and not something like a tag
+	head := bitbucketHead(hook)
+	if head == nil {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// ignore the hook if builds are disabled
+	if repo.Disabled {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// Get the user that owns the repository
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	// Verify that the commit doesn't already exist.
+	// We should never build the same commit twice.
+	_, err = database.GetCommitHash(head.Hash, repo.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return RenderText(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+
+	commit := &Commit{}
+	commit.RepoID = repo.ID
+	commit.Branch = head.Branch
+	commit.Hash = head.Hash
+	commit.Status = "Pending"
+	commit.Attempts = 1
+	commit.Created = time.Now().UTC()
+	commit.Message = head.Message
+	commit.Timestamp = head.Timestamp
+	commit.SetAuthor(parseBitbucketEmail(head.Author))
+
+	// store the files changed by the push, which are
+	// used to filter builds by path.
+	commit.Files = strings.Join(changedBitbucketFiles(hook), "\n")
+
+	// commits that instruct Drone to skip the build
+	// are saved, so that the user knows why a build
+	// wasn't triggered.
+	if isSkipCommit(commit.Message) {
+		if err := saveSkippedCommit(commit); err != nil {
+			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// get the drone.yml file from Bitbucket and parse
+	// the build script
+	buildscript, err := fetchBuildScript(user, repo, commit)
+	if err != nil {
+		if err := saveFailedBuild(commit, err.Error()); err != nil {
+			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	// ignore the hook if the branch is excluded
+	// by the build script
+	if !isBuildBranch(buildscript, commit) {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// commits that don't change any of the paths
+	// listed in the build script are skipped.
+	if !buildscript.Paths.Match(commit.FileList()) {
+		if err := saveSkippedCommit(commit); err != nil {
+			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// save the commit to the database
+	if err := database.SaveCommit(commit); err != nil {
+		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	// save the builds to the database and add
+	// them to the build queue
+	if err := enqueue(h.queue, repo, commit, buildscript); err != nil {
+		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	// OK!
+	return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+}
+
+// Processes a generic POST hook sent by a custom git server,
+// for example from a post-receive hook, and attempts to trigger
+// a build. The hook must be authenticated with an API token of a
+// user with write access to the repository.
+func (h *HookHandler) HookCustom(w http.ResponseWriter, r *http.Request) error {
+	// get the user that sent the hook
+	user, err := readUser(r)
+	if err != nil {
+		return RenderText(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+
+	// get the repo from the URL
+	repoId := r.FormValue("id")
+
+	// get the repo from the database, return error if not found
+	repo, err := database.GetRepoSlug(repoId)
+	if err != nil || repo.Host != HostCustom || !isRepoWriter(user, repo) {
+		return RenderText(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	// ignore the hook if builds are disabled
+	if repo.Disabled {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	branch := r.FormValue("branch")
+	hash := r.FormValue("sha")
+	if len(branch) == 0 {
+		branch = repo.DefaultBranch()
+	}
+
+	// ignore branch deletions
+	if hash == "0000000000000000000000000000000000000000" {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// the branch and sha are passed to the scm commands,
+	// and must not be mistaken for command line options.
+	if !isValidRef(branch) || (len(hash) != 0 && !isValidHash(repo, hash)) {
+		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	commit := &Commit{}
+	commit.Hash = hash
+	commit.Message = r.FormValue("message")
+	commit.Timestamp = r.FormValue("timestamp")
+	commit.SetAuthor(r.FormValue("author"))
+
+	// if no sha is provided the head commit of
+	// the branch is read from the repository.
+	if len(hash) == 0 {
+		commit, err = getCustomCommit(repo, branch, branch)
+		if err != nil {
+			return RenderError(w, err, http.StatusBadRequest)
+		}
+	}
+
+	// Verify that the commit doesn't already exist.
+	// We should never build the same commit twice.
+	_, err = database.GetCommitHash(commit.Hash, repo.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return RenderText(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+
+	commit.RepoID = repo.ID
+	commit.Branch = branch
+	commit.Status = "Pending"
+	commit.Attempts = 1
+	commit.Created = time.Now().UTC()
+
+	// commits that instruct Drone to skip the build
+	// are saved, so that the user knows why a build
+	// wasn't triggered.
+	if isSkipCommit(commit.Message) {
+		if err := saveSkippedCommit(commit); err != nil {
+			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// get the drone.yml file from the repository
+	// and parse the build script
+	buildscript, err := fetchBuildScript(user, repo, commit)
+	if err != nil {
+		if err := saveFailedBuild(commit, err.Error()); err != nil {
+			return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return RenderText(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	// ignore the hook if the branch is excluded
+	// by the build script
+	if !isBuildBranch(buildscript, commit) {
+		return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+
+	// save the commit to the database
+	if err := database.SaveCommit(commit); err != nil {
+		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	// save the builds to the database and add
+	// them to the build queue
+	if err := enqueue(h.queue, repo, commit, buildscript); err != nil {
+		return RenderText(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	// OK!
+	return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+}
+
+// Helper method for fetching the .drone.yml file from the
+// repository host and parsing the build script for the given
+// commit. The returned error message is suitable for display
+// to the user.
+func fetchBuildScript(user *User, repo *Repo, commit *Commit) (*script.Build, error) {
+	var raw []byte
+	var err error
+
+	// get the drone.yml file from the repository host
+	switch repo.Host {
+	case HostBitbucket:
+		raw, err = fetchBitbucketFile(user, repo, ".drone.yml", commit.Hash)
+	case HostCustom:
+		raw, err = fetchCustomFile(repo, ".drone.yml", commit)
+	default:
+		raw, err = fetchGitHubFile(user, repo, ".drone.yml", commit.Hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// parse the build script. The repository params are
+	// never injected into pull requests.
+	params := repo.Params
+	if len(commit.PullRequest) != 0 {
+		params = nil
+	}
+	buildscript, err := script.ParseBuild(raw, params)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse your .drone.yml file.  It needs to be a valid drone yaml file.\n\n%s\n", err.Error())
+	}
+
+	return buildscript, nil
+}
+
+// Helper method that returns true if the GitHub hook is signed
+// using the repository secret. Repositories that were added
+// before hook secrets were supported are rejected until the hook
+// is reset from the repository settings. The request body can be
+// read again.
+func verifyGitHubHook(r *http.Request) bool {
+	slug := r.URL.Query().Get("id")
+	repo, err := database.GetRepoSlug(slug)
+	if err != nil {
+		log.Printf("rejected hook for %s. could not find the repository. %s", slug, err)
+		return false
+	}
+	if len(repo.HookSecret) == 0 {
+		log.Printf("rejected hook for %s. the repository has no hook secret", slug)
+		return false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("rejected hook for %s. could not read the payload. %s", slug, err)
+		return false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	signature := r.Header.Get("X-Hub-Signature")
+	switch {
+	case len(signature) == 0 && repo.HookOutdated:
+		log.Printf("rejected hook for %s. the hook is not signed, and must be reset from the repository settings", slug)
+		return false
+	case len(signature) == 0:
+		log.Printf("rejected hook for %s. the hook is not signed", slug)
+		return false
+	case !verifyGitHubSignature(repo.HookSecret, signature, body):
+		log.Printf("rejected hook for %s. the signature does not match the hook secret", slug)
+		return false
+	}
+	return true
+}
+
+// Helper method that returns true if the Bitbucket hook was
+// sent to the URL that includes the repository secret, since
+// Bitbucket doesn't sign the hook payload.
+func verifyBitbucketHook(r *http.Request, repo *Repo) bool {
+	token := r.URL.Query().Get("token")
+	switch {
+	case len(repo.HookSecret) == 0:
+		log.Printf("rejected hook for %s. the repository has no hook secret", repo.Slug)
+		return false
+	case subtle.ConstantTimeCompare([]byte(token), []byte(repo.HookSecret)) != 1:
+		log.Printf("rejected hook for %s. the token does not match the hook secret", repo.Slug)
+		return false
+	}
+	return true
+}
+
+// Helper method that returns true if the pull request can be
+// built without approval. A pull request opened from a branch
+// of the repository is trusted, since the author can push to the
+// repository. A pull request opened from a fork is only trusted
+// if the author has write access to the repository in Drone.
+func isTrustedPullRequest(repo *Repo, hook *github.PullRequestHook) bool {
+	// the label of the head and base refs includes
+	// the repository owner, for example drone:master
+	head := strings.SplitN(hook.PullRequest.Head.Label, ":", 2)[0]
+	base := strings.SplitN(hook.PullRequest.Base.Label, ":", 2)[0]
+	if len(head) != 0 && head == base {
+		return true
+	}
+
+	login := hook.PullRequest.User.Login
+	if len(login) == 0 {
+		return false
+	}
+	user, err := database.GetUserGithubLogin(login)
+	if err != nil {
+		return false
+	}
+	return isRepoWriter(user, repo)
+}
+
+// Helper method for creating a build for each entry in the
+// build matrix and adding them to the build queue. Builds
+// are numbered after any builds from previous attempts.
+func enqueue(q *queue.Queue, repo *Repo, commit *Commit, buildscript *script.Build) error {
+	builds, err := database.ListBuilds(commit.ID)
+	if err != nil {
+		return err
+	}
+
+	var tasks []*queue.BuildTask
+	for i, s := range buildscript.Builds() {
+		build := &Build{}
+		build.Slug = strconv.Itoa(len(builds) + i + 1)
+		build.Attempt = commit.Attempts
+		build.CommitID = commit.ID
+		build.Created = time.Now().UTC()
+		build.Axis = i
+		tasks = append(tasks, &queue.BuildTask{Repo: repo, Commit: commit, Build: build, Script: s})
+	}
+
+	return q.Add(tasks...)
+}
+
+// Helper method that returns true if the commit message
+// instructs Drone to skip the build, using [ci skip] or
+// [skip ci].
+func isSkipCommit(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "[ci skip]") ||
+		strings.Contains(message, "[skip ci]")
+}
+
+// Helper method that returns true if the commit should be
+// built, based on the branches listed in the build script.
+// Pull requests are matched using the base branch, and tags
+// are always built.
+func isBuildBranch(buildscript *script.Build, commit *Commit) bool {
+	switch {
+	case len(commit.Tag) != 0:
+		return true
+	case len(commit.PullRequest) != 0:
+		return buildscript.Branches.Match(commit.BaseBranch)
+	default:
+		return buildscript.Branches.Match(commit.Branch)
+	}
+}
+
+// Helper method that returns the list of files added,
+// modified or removed by the commits in a GitHub push.
+func changedFiles(hook *github.PostReceiveHook) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, c := range hook.Commits {
+		for _, list := range [][]string{c.Added, c.Modified, c.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// Helper method that returns the most recent commit pushed
+// to a branch in a Bitbucket push, or nil if the push did not
+// include any commits. Only the last commit pushed to each
+// branch includes the branch name.
+func bitbucketHead(hook *bitbucket.PostReceiveHook) *bitbucket.Commit {
+	for i := len(hook.Commits) - 1; i >= 0; i-- {
+		if len(hook.Commits[i].Branch) != 0 {
+			return hook.Commits[i]
+		}
+	}
+	return nil
+}
+
+// Helper method that returns the list of files added,
+// modified or removed by the commits in a Bitbucket push.
+func changedBitbucketFiles(hook *bitbucket.PostReceiveHook) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, c := range hook.Commits {
+		for _, file := range c.Files {
+			if !seen[file.File] {
+				seen[file.File] = true
+				files = append(files, file.File)
+			}
+		}
+	}
+	return files
+}
+
+// Helper method for saving a commit that is skipped, so
+// that the user knows why a build wasn't triggered.
+func saveSkippedCommit(commit *Commit) error {
+	commit.Status = StatusSkipped
+	commit.Finished = commit.Created
+	commit.Duration = 0
+	return database.SaveCommit(commit)
+}
+
 // Helper method for saving a failed build or commit in the case where it never starts to build.
 // This can happen if the yaml is bad or doesn't exist.
 func saveFailedBuild(commit *Commit, msg string) error {
@@ -306,7 +820,8 @@ func saveFailedBuild(commit *Commit, msg string) error {
 
 	// save the build to the database
 	build := &Build{}
-	build.Slug = "1" // TODO: This should not be hardcoded
+	build.Slug = "1"
+	build.Attempt = commit.Attempts
 	build.CommitID = commit.ID
 	build.Created = time.Now().UTC()
 	build.Finished = build.Created
@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drone/drone/pkg/database"
+	. "github.com/drone/drone/pkg/model"
+	"github.com/drone/drone/pkg/queue"
+)
+
+type QueueHandler struct {
+	queue *queue.Queue
+}
+
+func NewQueueHandler(queue *queue.Queue) *QueueHandler {
+	return &QueueHandler{
+		queue: queue,
+	}
+}
+
+// Display a list of all Pending and Started builds
+// in the build queue.
+func (h *QueueHandler) AdminQueue(w http.ResponseWriter, r *http.Request, u *User) error {
+	tasks, err := h.queue.List()
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		User  *User
+		Tasks []*queue.BuildTask
+	}{u, tasks}
+
+	return RenderTemplate(w, "admin_queue.html", &data)
+}
+
+// Cancel a build in the build queue.
+func (h *QueueHandler) AdminQueueCancel(w http.ResponseWriter, r *http.Request, u *User) error {
+	// get the ID from the URL parameter
+	idstr := r.FormValue("id")
+	id, err := strconv.Atoi(idstr)
+	if err != nil {
+		return err
+	}
+
+	if err := h.queue.Cancel(int64(id)); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/account/admin/queue", http.StatusSeeOther)
+	return nil
+}
+
+// Cancel a Pending or Started build for the repository.
+func (h *QueueHandler) BuildCancel(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	hash := r.FormValue(":commit")
+	labl := r.FormValue(":label")
+
+	// get the commit from the database
+	commit, err := database.GetCommitHash(hash, repo.ID)
+	if err != nil {
+		return err
+	}
+
+	// get the build from the database
+	build, err := database.GetBuildSlug(labl, commit.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.queue.Cancel(build.ID); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/commit/%s/build/%s", repo.Slug, commit.Hash, build.Slug), http.StatusSeeOther)
+	return nil
+}
+
+// Restart the build for a commit. The .drone.yml file is
+// fetched again, and a new build is added to the queue for
+// each entry in the build matrix.
+func (h *QueueHandler) CommitRestart(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	hash := r.FormValue(":commit")
+
+	// get the commit from the database
+	commit, err := database.GetCommitHash(hash, repo.ID)
+	if err != nil {
+		return err
+	}
+
+	// the commit cannot be restarted while it is still running
+	if commit.IsRunning() {
+		return fmt.Errorf("Commit %s is already running", commit.HashShort())
+	}
+
+	// the commit cannot be restarted until it is approved
+	if commit.IsApproval() {
+		return fmt.Errorf("Commit %s is waiting for approval", commit.HashShort())
+	}
+
+	if err := h.rebuild(repo, commit); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/commit/%s", repo.Slug, commit.Hash), http.StatusSeeOther)
+	return nil
+}
+
+// Approve a pull request that is waiting for approval, and
+// add a new build to the queue for each entry in the build
+// matrix.
+func (h *QueueHandler) CommitApprove(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	hash := r.FormValue(":commit")
+
+	// get the commit from the database
+	commit, err := database.GetCommitHash(hash, repo.ID)
+	if err != nil {
+		return err
+	}
+
+	if !commit.IsApproval() {
+		return fmt.Errorf("Commit %s is not waiting for approval", commit.HashShort())
+	}
+
+	// get the user that owns the repository, since
+	// we need his / her GitHub token
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return err
+	}
+
+	// the commit fails if the build script can't be
+	// fetched, so that it is no longer waiting.
+	buildscript, err := fetchBuildScript(user, repo, commit)
+	if err != nil {
+		if err := saveFailedBuild(commit, err.Error()); err != nil {
+			return err
+		}
+	} else {
+		commit.Status = StatusEnqueue
+		if err := database.SaveCommit(commit); err != nil {
+			return err
+		}
+		if err := enqueue(h.queue, repo, commit, buildscript); err != nil {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/commit/%s", repo.Slug, commit.Hash), http.StatusSeeOther)
+	return nil
+}
+
+// Build a branch or specific commit for the repository. If no
+// sha is provided the head commit of the branch is built. If
+// the commit was built before it is restarted.
+func (h *QueueHandler) RepoBuild(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	branch := r.FormValue("branch")
+	ref := r.FormValue("sha")
+
+	// if no branch is provided then we'll
+	// want to use a default value.
+	if len(branch) == 0 {
+		branch = repo.DefaultBranch()
+	}
+	if len(ref) == 0 {
+		ref = branch
+	}
+
+	// get the user that owns the repository, since
+	// we need his / her GitHub or Bitbucket token
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return err
+	}
+
+	// resolve the branch or sha using the host API
+	head, err := getCommit(user, repo, branch, ref)
+	if err != nil {
+		return err
+	}
+
+	commit, err := database.GetCommitHash(head.Hash, repo.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		// this commit has never been built
+		commit = head
+		commit.RepoID = repo.ID
+		commit.Branch = branch
+		commit.Created = time.Now().UTC()
+	case err != nil:
+		return err
+	case commit.IsRunning():
+		return fmt.Errorf("Commit %s is already running", commit.HashShort())
+	case commit.IsApproval():
+		// a pull request must be approved before it is built
+		return fmt.Errorf("Commit %s is waiting for approval", commit.HashShort())
+	}
+
+	if err := h.rebuild(repo, commit); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s/commit/%s", repo.Slug, commit.Hash), http.StatusSeeOther)
+	return nil
+}
+
+// Helper method for fetching the .drone.yml file and adding
+// a new attempt of the commit to the build queue.
+func (h *QueueHandler) rebuild(repo *Repo, commit *Commit) error {
+	// get the user that owns the repository, since
+	// we need his / her GitHub or Bitbucket token
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return err
+	}
+
+	buildscript, err := fetchBuildScript(user, repo, commit)
+	if err != nil {
+		return err
+	}
+
+	// reset the commit status for the new attempt
+	commit.Attempts++
+	commit.Status = StatusEnqueue
+	commit.Duration = 0
+	if err := database.SaveCommit(commit); err != nil {
+		return err
+	}
+
+	return enqueue(h.queue, repo, commit, buildscript)
+}
+
+// Helper method for retrieving the details of the given branch,
+// tag or sha from the repository host. The returned Commit is
+// not persisted.
+func getCommit(user *User, repo *Repo, branch, ref string) (*Commit, error) {
+	commit := &Commit{}
+	switch repo.Host {
+	case HostBitbucket:
+		head, err := getBitbucketCommit(user, repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		commit.Hash = head.RawNode
+		commit.Message = head.Message
+		commit.Timestamp = head.UtcTimestamp
+		commit.SetAuthor(parseBitbucketEmail(head.RawAuthor))
+	case HostCustom:
+		return getCustomCommit(repo, branch, ref)
+	default:
+		head, err := getGitHubCommit(user, repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		commit.Hash = head.Sha
+		commit.Message = head.Commit.Message
+		commit.Timestamp = head.Commit.Author.Date
+		commit.SetAuthor(head.Commit.Author.Email)
+	}
+	return commit, nil
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/drone/drone/pkg/channel"
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
+	"github.com/drone/go-bitbucket/bitbucket"
 	"github.com/drone/go-github/github"
 
 	"launchpad.net/goyaml"
@@ -40,6 +43,9 @@ func RepoDashboard(w http.ResponseWriter, r *http.Request, u *User, repo *Repo)
 	// for a stream of changes for this repository
 	token := channel.Create(repo.Slug)
 
+	// only the repository admins can trigger a build
+	admin := u != nil && isRepoAdmin(u, repo)
+
 	data := struct {
 		User     *User
 		Repo     *Repo
@@ -47,7 +53,8 @@ func RepoDashboard(w http.ResponseWriter, r *http.Request, u *User, repo *Repo)
 		Commits  []*Commit
 		Branch   string
 		Token    string
-	}{u, repo, branches, commits, branch, token}
+		Admin    bool
+	}{u, repo, branches, commits, branch, token, admin}
 
 	return RenderTemplate(w, "repo_dashboard.html", &data)
 }
@@ -131,10 +138,12 @@ func RepoCreateGithub(w http.ResponseWriter, r *http.Request, u *User) error {
 
 	// create a hook so that we get notified when code
 	// is pushed to the repository and can execute a build.
+	// the hook payload is signed using the repository secret.
+	repo.ResetHookSecret()
 	link := fmt.Sprintf("%s://%s/hook/github.com?id=%s", settings.Scheme, settings.Domain, repo.Slug)
 
 	// add the hook
-	if _, err := client.Hooks.CreateUpdate(owner, name, link); err != nil {
+	if err := createGitHubHook(u, repo, link); err != nil {
 		return fmt.Errorf("Unable to add Hook to your GitHub repository.")
 	}
 
@@ -146,6 +155,193 @@ func RepoCreateGithub(w http.ResponseWriter, r *http.Request, u *User) error {
 	return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
 }
 
+func RepoAddBitbucket(w http.ResponseWriter, r *http.Request, u *User) error {
+	settings := database.SettingsMust()
+	teams, err := database.ListTeams(u.ID)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		User     *User
+		Teams    []*Team
+		Settings *Settings
+	}{u, teams, settings}
+	// if the user hasn't linked their Bitbucket account
+	// render a different template
+	if len(u.BitbucketToken) == 0 {
+		return RenderTemplate(w, "bitbucket_link.html", &data)
+	}
+	// otherwise display the template for adding
+	// a new Bitbucket repository.
+	return RenderTemplate(w, "bitbucket_add.html", &data)
+}
+
+func RepoCreateBitbucket(w http.ResponseWriter, r *http.Request, u *User) error {
+	teamName := r.FormValue("team")
+	owner := r.FormValue("owner")
+	name := r.FormValue("name")
+
+	// get the bitbucket settings from the database
+	settings := database.SettingsMust()
+
+	// create the Bitbucket client
+	client := newBitbucketClient(u)
+	bitbucketRepo, err := client.Repos.Find(owner, name)
+	if err != nil {
+		return fmt.Errorf("Unable to find Bitbucket repository %s/%s.", owner, name)
+	}
+
+	var repo *Repo
+	switch bitbucketRepo.Scm {
+	case ScmHg:
+		repo, err = NewBitbucketHgRepo(owner, name, bitbucketRepo.Private)
+	default:
+		repo, err = NewBitbucketRepo(owner, name, bitbucketRepo.Private)
+	}
+	if err != nil {
+		return err
+	}
+
+	repo.UserID = u.ID
+	repo.Private = bitbucketRepo.Private
+
+	// if the user chose to assign to a team account
+	// we need to retrieve the team, verify the user
+	// has access, and then set the team id.
+	if len(teamName) > 0 {
+		team, err := database.GetTeamSlug(teamName)
+		if err != nil {
+			return fmt.Errorf("Unable to find Team %s.", teamName)
+		}
+
+		// user must be an admin member of the team
+		if ok, _ := database.IsMemberAdmin(u.ID, team.ID); !ok {
+			return fmt.Errorf("Invalid permission to access Team %s.", teamName)
+		}
+
+		repo.TeamID = team.ID
+	}
+
+	// if the repository is private we'll need
+	// to upload a deploy key to the repository
+	if repo.Private {
+		// name the key
+		keyName := fmt.Sprintf("%s@%s", repo.Owner, settings.Domain)
+
+		// create the bitbucket key, or update if one already exists
+		if _, err := client.RepoKeys.CreateUpdate(owner, name, repo.PublicKey, keyName); err != nil {
+			return fmt.Errorf("Unable to add Public Key to your Bitbucket repository.")
+		}
+	}
+
+	// create a hook so that we get notified when code
+	// is pushed to the repository and can execute a build.
+	// Bitbucket doesn't sign the payload, so the hook is
+	// authenticated using the secret in the URL.
+	repo.ResetHookSecret()
+	link := fmt.Sprintf("%s://%s/hook/bitbucket.org?id=%s&token=%s", settings.Scheme, settings.Domain, repo.Slug, repo.HookSecret)
+
+	// add the hook
+	if _, err := client.Brokers.CreateUpdate(owner, name, link, bitbucket.BrokerTypePost); err != nil {
+		return fmt.Errorf("Unable to add Hook to your Bitbucket repository.")
+	}
+
+	// Save to the database
+	if err := database.SaveRepo(repo); err != nil {
+		return fmt.Errorf("Error saving repository to the database. %s", err)
+	}
+
+	return RenderText(w, http.StatusText(http.StatusOK), http.StatusOK)
+}
+
+func RepoAddCustom(w http.ResponseWriter, r *http.Request, u *User) error {
+	settings := database.SettingsMust()
+	teams, err := database.ListTeams(u.ID)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		User     *User
+		Teams    []*Team
+		Settings *Settings
+	}{u, teams, settings}
+	return RenderTemplate(w, "custom_add.html", &data)
+}
+
+func RepoCreateCustom(w http.ResponseWriter, r *http.Request, u *User) error {
+	teamName := r.FormValue("team")
+	url := strings.TrimSpace(r.FormValue("url"))
+	owner := r.FormValue("owner")
+	name := r.FormValue("name")
+	scm := r.FormValue("scm")
+
+	if len(url) == 0 {
+		return fmt.Errorf("Repository clone URL is required.")
+	}
+
+	// if no source control system is provided
+	// we'll assume the repository uses git.
+	switch scm {
+	case "":
+		scm = ScmGit
+	case ScmGit, ScmHg, ScmSvn:
+	default:
+		return fmt.Errorf("Unsupported source control system %s.", scm)
+	}
+
+	// the repository is fetched on the host machine, so the
+	// clone url can't be a local path or a command line option.
+	if !isValidCloneURL(scm, url) {
+		return fmt.Errorf("Invalid clone URL %s.", url)
+	}
+
+	// if no owner or name are provided we'll
+	// use the values from the clone URL.
+	urlOwner, urlName := parseCloneURL(url)
+	if len(owner) == 0 {
+		owner = urlOwner
+	}
+	if len(name) == 0 {
+		name = urlName
+	}
+	if len(owner) == 0 || len(name) == 0 {
+		return fmt.Errorf("Unable to determine the repository owner and name from %s.", url)
+	}
+
+	repo, err := NewCustomRepo(owner, name, scm, url)
+	if err != nil {
+		return err
+	}
+
+	repo.UserID = u.ID
+	repo.Private = len(r.FormValue("private")) > 0
+
+	// if the user chose to assign to a team account
+	// we need to retrieve the team, verify the user
+	// has access, and then set the team id.
+	if len(teamName) > 0 {
+		team, err := database.GetTeamSlug(teamName)
+		if err != nil {
+			return fmt.Errorf("Unable to find Team %s.", teamName)
+		}
+
+		// user must be an admin member of the team
+		if ok, _ := database.IsMemberAdmin(u.ID, team.ID); !ok {
+			return fmt.Errorf("Invalid permission to access Team %s.", teamName)
+		}
+
+		repo.TeamID = team.ID
+	}
+
+	// Save to the database. The user must add the public key
+	// to their git server, and configure the post-receive hook.
+	if err := database.SaveRepo(repo); err != nil {
+		return fmt.Errorf("Error saving repository to the database. %s", err)
+	}
+
+	return RenderText(w, repo.Slug, http.StatusOK)
+}
+
 // Repository Settings
 func RepoSettingsForm(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
 
@@ -210,13 +406,48 @@ func RepoBadges(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) err
 }
 
 func RepoKeys(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	// hostname from settings
+	hostname := database.SettingsMust().URL().String()
+
 	data := struct {
 		Repo *Repo
 		User *User
-	}{repo, u}
+		Host string
+	}{repo, u, hostname}
 	return RenderTemplate(w, "repo_keys.html", &data)
 }
 
+// Generates a new hook secret for the GitHub repository, and
+// updates the hook so that GitHub signs the payload using the
+// new secret.
+func RepoHookSecretReset(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
+	if repo.Host == HostBitbucket || repo.Host == HostCustom {
+		return fmt.Errorf("Hook secrets are only supported for GitHub repositories.")
+	}
+
+	// get the user that owns the repository, since
+	// we need his / her GitHub token
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return err
+	}
+
+	settings := database.SettingsMust()
+	link := fmt.Sprintf("%s://%s/hook/github.com?id=%s", settings.Scheme, settings.Domain, repo.Slug)
+
+	repo.ResetHookSecret()
+	if err := createGitHubHook(user, repo, link); err != nil {
+		return fmt.Errorf("Unable to update the Hook of your GitHub repository.")
+	}
+	repo.HookOutdated = false
+	if err := database.SaveRepo(repo); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/"+repo.Slug+"/settings", http.StatusSeeOther)
+	return nil
+}
+
 // Updates an existing repository.
 func RepoUpdate(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) error {
 	switch r.FormValue("action") {
@@ -231,6 +462,34 @@ func RepoUpdate(w http.ResponseWriter, r *http.Request, u *User, repo *Repo) err
 
 		repo.Privileged = u.Admin && len(r.FormValue("Privileged")) > 0
 
+		// only administrators can change the timeout. a value
+		// of zero indicates the system default should be used.
+		if u.Admin && len(r.FormValue("Timeout")) > 0 {
+			timeout, err := strconv.ParseInt(r.FormValue("Timeout"), 10, 64)
+			if err != nil || timeout < 0 {
+				return fmt.Errorf("Invalid build timeout %s", r.FormValue("Timeout"))
+			}
+			repo.Timeout = timeout
+		}
+
+		// only administrators can change the memory limit and
+		// CPU weight. a value of zero indicates the Docker
+		// default should be used.
+		if u.Admin && len(r.FormValue("Memory")) > 0 {
+			memory, err := strconv.ParseInt(r.FormValue("Memory"), 10, 64)
+			if err != nil || memory < 0 {
+				return fmt.Errorf("Invalid build memory limit %s", r.FormValue("Memory"))
+			}
+			repo.Memory = memory
+		}
+		if u.Admin && len(r.FormValue("CpuShares")) > 0 {
+			shares, err := strconv.ParseInt(r.FormValue("CpuShares"), 10, 64)
+			if err != nil || shares < 0 {
+				return fmt.Errorf("Invalid build CPU shares %s", r.FormValue("CpuShares"))
+			}
+			repo.CpuShares = shares
+		}
+
 		// value of "" indicates the currently authenticated user
 		// should be set as the administrator.
 		if len(r.FormValue("Owner")) == 0 {
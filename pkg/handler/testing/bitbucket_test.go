@@ -0,0 +1,55 @@
+package testing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/pkg/database"
+	"github.com/drone/drone/pkg/handler"
+	"github.com/drone/drone/pkg/model"
+
+	dbtest "github.com/drone/drone/pkg/database/testing"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Tests that the Bitbucket hook is authenticated using
+// the repository secret.
+func Test_BitbucketHook(t *testing.T) {
+	// seed the database with values
+	dbtest.Setup()
+	defer dbtest.Teardown()
+
+	repo, _ := model.NewBitbucketRepo("example", "hook", false)
+	repo.UserID = 1
+	repo.ResetHookSecret()
+	database.SaveRepo(repo)
+
+	// sends a hook, without commits, for the repository
+	send := func(token string) int {
+		query := url.Values{}
+		query.Set("id", repo.Slug)
+		query.Set("token", token)
+		form := url.Values{}
+		form.Set("payload", `{"commits":[]}`)
+		req, _ := http.NewRequest("POST", "/hook/bitbucket.org?"+query.Encode(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		handler.NewHookHandler(nil).HookBitbucket(res, req)
+		return res.Code
+	}
+
+	Convey("Given a hook for a Bitbucket repository", t, func() {
+		Convey("When the token is missing", func() {
+			So(send(""), ShouldEqual, http.StatusForbidden)
+		})
+		Convey("When the token does not match the secret", func() {
+			So(send("invalid"), ShouldEqual, http.StatusForbidden)
+		})
+		Convey("When the token matches the secret", func() {
+			So(send(repo.HookSecret), ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,229 @@
+package testing
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/pkg/database"
+	"github.com/drone/drone/pkg/handler"
+
+	dbtest "github.com/drone/drone/pkg/database/testing"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Tests the ability to create repositories hosted
+// on a custom git server.
+func Test_CustomCreate(t *testing.T) {
+	// seed the database with values
+	dbtest.Setup()
+	defer dbtest.Teardown()
+
+	// mock request
+	req := http.Request{}
+	req.Form = url.Values{}
+
+	// get user that will add repositories
+	user, _ := database.GetUser(1)
+
+	Convey("Given request to setup a custom git repo", t, func() {
+
+		Convey("When the owner and name are not provided", func() {
+			req.Form.Set("url", "git@git.example.com:example/custom.git")
+			req.Form.Set("owner", "")
+			req.Form.Set("name", "")
+			req.Form.Set("private", "true")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+			repo, _ := database.GetRepoSlug("custom/example/custom")
+
+			Convey("The repository is created", func() {
+				So(err, ShouldBeNil)
+				So(repo, ShouldNotBeNil)
+				So(repo.ID, ShouldNotEqual, 0)
+				So(repo.Owner, ShouldEqual, "example")
+				So(repo.Name, ShouldEqual, "custom")
+				So(repo.Host, ShouldEqual, "custom")
+				So(repo.URL, ShouldEqual, "git@git.example.com:example/custom.git")
+				So(repo.UserID, ShouldEqual, user.ID)
+				So(repo.Private, ShouldEqual, true)
+				So(repo.SCM, ShouldEqual, "git")
+				So(res.Body.String(), ShouldEqual, "custom/example/custom")
+			})
+		})
+
+		Convey("When the owner and name are provided", func() {
+			req.Form.Set("url", "https://git.example.com/repos/project.git")
+			req.Form.Set("owner", "example")
+			req.Form.Set("name", "named")
+			req.Form.Set("private", "")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+			repo, _ := database.GetRepoSlug("custom/example/named")
+
+			Convey("The repository is created", func() {
+				So(err, ShouldBeNil)
+				So(repo, ShouldNotBeNil)
+				So(repo.ID, ShouldNotEqual, 0)
+				So(repo.Private, ShouldEqual, false)
+			})
+		})
+
+		Convey("When the repository is a Mercurial repository", func() {
+			req.Form.Set("url", "ssh://hg@hg.example.com/example/mercurial")
+			req.Form.Set("owner", "")
+			req.Form.Set("name", "")
+			req.Form.Set("scm", "hg")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+			repo, _ := database.GetRepoSlug("custom/example/mercurial")
+
+			Convey("The repository is created", func() {
+				So(err, ShouldBeNil)
+				So(repo, ShouldNotBeNil)
+				So(repo.SCM, ShouldEqual, "hg")
+				So(repo.DefaultBranch(), ShouldEqual, "default")
+			})
+		})
+
+		Convey("When the source control system is not supported", func() {
+			req.Form.Set("url", "https://bzr.example.com/example/bazaar")
+			req.Form.Set("owner", "")
+			req.Form.Set("name", "")
+			req.Form.Set("scm", "bzr")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+
+			Convey("The result is an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Unsupported source control system bzr.")
+			})
+		})
+
+		Convey("When the clone url is a command line option", func() {
+			req.Form.Set("url", "--upload-pack=touch /tmp/drone-test /a/b")
+			req.Form.Set("owner", "example")
+			req.Form.Set("name", "option")
+			req.Form.Set("scm", "")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+
+			Convey("The result is an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "Invalid clone URL")
+			})
+		})
+
+		Convey("When the clone url is a local path", func() {
+			for _, u := range []string{"file:///var/lib/repo.git", "/var/lib/repo.git", "../repo.git", "ssh://-oProxyCommand=touch/repo.git"} {
+				req.Form.Set("url", u)
+				req.Form.Set("owner", "example")
+				req.Form.Set("name", "local")
+				req.Form.Set("scm", "")
+				res := httptest.NewRecorder()
+				err := handler.RepoCreateCustom(res, &req, user)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "Invalid clone URL")
+			}
+		})
+
+		Convey("When the clone url is not provided", func() {
+			req.Form.Set("url", "")
+			req.Form.Set("owner", "example")
+			req.Form.Set("name", "nourl")
+			res := httptest.NewRecorder()
+			err := handler.RepoCreateCustom(res, &req, user)
+
+			Convey("The result is an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Repository clone URL is required.")
+			})
+		})
+	})
+}
+
+// Tests the ability to receive a hook for a repository hosted
+// on a custom git server, without allowing the request to pass
+// options to the git commands.
+func Test_CustomHook(t *testing.T) {
+	// seed the database with values
+	dbtest.Setup()
+	defer dbtest.Teardown()
+
+	dir, _ := ioutil.TempDir("", "drone-test-")
+	defer os.RemoveAll(dir)
+
+	tmp := os.Getenv("DRONE_TMP")
+	os.Setenv("DRONE_TMP", filepath.Join(dir, "tmp"))
+	defer os.Setenv("DRONE_TMP", tmp)
+
+	// create a git repository with a single commit
+	src := filepath.Join(dir, "src")
+	git := func(args ...string) string {
+		args = append([]string{"-c", "user.name=drone", "-c", "user.email=drone@localhost"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = src
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	os.Mkdir(src, 0700)
+	git("init", "--quiet")
+	git("commit", "--quiet", "--allow-empty", "-m", "initial commit")
+	git("branch", "-M", "master")
+	head := git("rev-parse", "HEAD")
+
+	// save the repository, and use the local git repository
+	// as the clone url, which can't be added by a user.
+	user, _ := database.GetUser(1)
+	req := http.Request{Form: url.Values{}}
+	req.Form.Set("url", "https://git.example.com/example/hook.git")
+	req.Form.Set("owner", "example")
+	req.Form.Set("name", "hook")
+	handler.RepoCreateCustom(httptest.NewRecorder(), &req, user)
+	repo, _ := database.GetRepoSlug("custom/example/hook")
+	repo.URL = "file://" + src
+	database.SaveRepo(repo)
+
+	// sends a hook for the repository
+	send := func(branch, sha string) int {
+		form := url.Values{}
+		form.Set("id", repo.Slug)
+		form.Set("branch", branch)
+		form.Set("sha", sha)
+		form.Set("access_token", user.Token)
+		req, _ := http.NewRequest("POST", "/hook/custom?"+form.Encode(), nil)
+		res := httptest.NewRecorder()
+		handler.NewHookHandler(nil).HookCustom(res, req)
+		return res.Code
+	}
+
+	Convey("Given a hook for a custom git repository", t, func() {
+		Convey("When the sha is a command line option", func() {
+			So(send("master", "--output=/tmp/drone-test"), ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("When the branch is a command line option", func() {
+			So(send("--upload-pack=touch", ""), ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("When no sha is provided", func() {
+			// the repository has no .drone.yml, so the
+			// build is saved as a failure.
+			So(send("master", ""), ShouldEqual, http.StatusBadRequest)
+
+			Convey("The head commit of the branch is saved", func() {
+				commit, err := database.GetCommitHash(head, repo.ID)
+				So(err, ShouldBeNil)
+				So(commit.Message, ShouldEqual, "initial commit")
+				So(commit.Status, ShouldEqual, "Failure")
+			})
+		})
+	})
+}
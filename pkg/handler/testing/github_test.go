@@ -1,11 +1,15 @@
 package testing
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/drone/drone/pkg/database"
@@ -182,6 +186,59 @@ func Test_GitHubCreate(t *testing.T) {
 	})
 }
 
+// Tests that GitHub hooks are verified using the repository secret.
+func Test_GitHubHookSignature(t *testing.T) {
+	// seed the database with values
+	SetupFixtures()
+	defer TeardownFixtures()
+
+	// save a repository with a hook secret
+	repo, _ := model.NewGitHubRepo("github.com", "example", "signed", false)
+	repo.UserID = 1
+	repo.HookSecret = "s3cr3t"
+	database.SaveRepo(repo)
+
+	// signs the payload using the given secret
+	sign := func(secret, payload string) string {
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write([]byte(payload))
+		return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	// sends a ping to the hook handler
+	send := func(signature string) int {
+		req, _ := http.NewRequest("POST", "/hook/github.com?id="+repo.Slug, strings.NewReader("zen=hello"))
+		req.Header.Set("X-Github-Event", "ping")
+		if len(signature) != 0 {
+			req.Header.Set("X-Hub-Signature", signature)
+		}
+		res := httptest.NewRecorder()
+		handler.NewHookHandler(nil).Hook(res, req)
+		return res.Code
+	}
+
+	Convey("Given a hook for a repository with a secret", t, func() {
+		Convey("When the signature is valid", func() {
+			So(send(sign("s3cr3t", "zen=hello")), ShouldEqual, http.StatusOK)
+		})
+		Convey("When the signature is invalid", func() {
+			So(send(sign("wrong", "zen=hello")), ShouldEqual, http.StatusForbidden)
+		})
+		Convey("When the signature is missing", func() {
+			So(send(""), ShouldEqual, http.StatusForbidden)
+		})
+	})
+
+	Convey("Given a hook for a repository without a secret", t, func() {
+		repo.HookSecret = ""
+		database.SaveRepo(repo)
+
+		Convey("When the hook is not signed", func() {
+			So(send(""), ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
+
 // this code should be refactored and centralized, but for now
 // it is just proof-of-concepting a testing strategy, so we'll
 // revisit later.
@@ -223,6 +280,10 @@ func SetupFixtures() {
 	})
 
 	mux.HandleFunc("/repos/example/public/hooks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
 		fmt.Fprintf(w, `{
 			"url": "https://api.github.com/repos/example/public/hooks/1",
 			"name": "web",
@@ -244,6 +305,10 @@ func SetupFixtures() {
 	})
 
 	mux.HandleFunc("/repos/example/private/hooks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
 		fmt.Fprintf(w, `{
 			"url": "https://api.github.com/repos/example/private/hooks/1",
 			"name": "web",
@@ -297,6 +362,10 @@ func SetupFixtures() {
 	})
 
 	mux.HandleFunc("/repos/example/keyerr/hooks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
 		fmt.Fprintf(w, `{
 			"url": "https://api.github.com/repos/example/keyerr/hooks/1",
 			"name": "web",
@@ -322,6 +391,10 @@ func SetupFixtures() {
 	})
 
 	mux.HandleFunc("/repos/example/team/hooks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
 		fmt.Fprintf(w, `{
 			"url": "https://api.github.com/repos/example/team/hooks/1",
 			"name": "web",
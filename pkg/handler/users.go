@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
@@ -109,3 +110,64 @@ func UserTeams(w http.ResponseWriter, r *http.Request, u *User) error {
 	}{u, teams}
 	return RenderTemplate(w, "user_teams.html", &data)
 }
+
+// return an HTML page listing the user's API tokens.
+func UserTokens(w http.ResponseWriter, r *http.Request, u *User) error {
+	tokens, err := database.ListTokens(u.ID)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		User   *User
+		Tokens []*Token
+	}{u, tokens}
+	return RenderTemplate(w, "user_tokens.html", &data)
+}
+
+// create a new named API token for the user.
+func UserTokenCreate(w http.ResponseWriter, r *http.Request, u *User) error {
+	name := r.FormValue("name")
+	if len(name) == 0 {
+		return RenderText(w, "Token name is required", http.StatusBadRequest)
+	}
+
+	token := NewToken(u.ID, name, len(r.FormValue("read_only")) > 0)
+	if err := database.SaveToken(token); err != nil {
+		return RenderError(w, err, http.StatusBadRequest)
+	}
+
+	http.Redirect(w, r, "/account/user/tokens", http.StatusSeeOther)
+	return nil
+}
+
+// revoke a named API token.
+func UserTokenDelete(w http.ResponseWriter, r *http.Request, u *User) error {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return err
+	}
+
+	// the token must belong to the user
+	token, err := database.GetToken(int64(id))
+	if err != nil || token.UserID != u.ID {
+		return RenderNotFound(w)
+	}
+
+	if err := database.DeleteToken(token.ID); err != nil {
+		return RenderError(w, err, http.StatusBadRequest)
+	}
+
+	http.Redirect(w, r, "/account/user/tokens", http.StatusSeeOther)
+	return nil
+}
+
+// regenerate the user's personal API token.
+func UserTokenReset(w http.ResponseWriter, r *http.Request, u *User) error {
+	u.ResetToken()
+	if err := database.SaveUser(u); err != nil {
+		return RenderError(w, err, http.StatusBadRequest)
+	}
+
+	http.Redirect(w, r, "/account/user/tokens", http.StatusSeeOther)
+	return nil
+}
@@ -12,12 +12,28 @@ const (
 	StatusSuccess = "Success"
 	StatusFailure = "Failure"
 	StatusError   = "Error"
+	StatusKilled  = "Killed"
+
+	// StatusConflict indicates a pull request
+	// can't be merged into the base branch.
+	StatusConflict = "Conflict"
+
+	// StatusApproval indicates a pull request must
+	// be approved by a user with write access before
+	// it is built.
+	StatusApproval = "Approval"
+
+	// StatusSkipped indicates a commit was not built,
+	// because the commit message includes [ci skip], or
+	// the changed files are excluded by the build script.
+	StatusSkipped = "Skipped"
 )
 
 type Build struct {
 	ID       int64     `meddler:"id,pk"            json:"id"`
 	CommitID int64     `meddler:"commit_id"        json:"-"`
 	Slug     string    `meddler:"slug"             json:"slug"`
+	Attempt  int64     `meddler:"attempt,zeroisnull" json:"attempt"`
 	Status   string    `meddler:"status"           json:"status"`
 	Started  time.Time `meddler:"started,utctime"  json:"started"`
 	Finished time.Time `meddler:"finished,utctime" json:"finished"`
@@ -25,6 +41,17 @@ type Build struct {
 	Created  time.Time `meddler:"created,utctime"  json:"created"`
 	Updated  time.Time `meddler:"updated,utctime"  json:"updated"`
 	Stdout   string    `meddler:"stdout"           json:"-"`
+
+	// Config stores the build instructions from
+	// the .drone.yml file, used to execute the
+	// build once it is pulled from the queue. The
+	// repository params are injected when the build
+	// is executed, and are never stored.
+	Config string `meddler:"config,zeroisnull" json:"-"`
+
+	// Axis is the index of the build in the build
+	// matrix of the .drone.yml file.
+	Axis int `meddler:"axis,zeroisnull" json:"-"`
 }
 
 // HumanDuration returns a human-readable approximation of a duration
@@ -59,6 +86,12 @@ func (b *Build) StartedString() string {
 	return b.Started.Format("2006-01-02T15:04:05Z")
 }
 
+// Returns the Created Date as an ISO8601
+// formatted string.
+func (b *Build) CreatedString() string {
+	return b.Created.Format("2006-01-02T15:04:05Z")
+}
+
 // Returns the Started Date as an ISO8601
 // formatted string.
 func (b *Build) FinishedString() string {
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,14 +13,23 @@ type Commit struct {
 	Started     time.Time `meddler:"started,utctime"  json:"started"`
 	Finished    time.Time `meddler:"finished,utctime" json:"finished"`
 	Duration    int64     `meddler:"duration"         json:"duration"`
+	Attempts    int64     `meddler:"attempts,zeroisnull" json:"attempts"`
 	Hash        string    `meddler:"hash"             json:"hash"`
 	Branch      string    `meddler:"branch"           json:"branch"`
+	Tag         string    `meddler:"tag,zeroisnull"   json:"tag"`
 	PullRequest string    `meddler:"pull_request"     json:"pull_request"`
+	BaseBranch  string    `meddler:"base_branch,zeroisnull" json:"base_branch"`
+	BaseHash    string    `meddler:"base_hash,zeroisnull"   json:"base_hash"`
+	Untrusted   bool      `meddler:"untrusted,zeroisnull"   json:"untrusted"`
 	Author      string    `meddler:"author"           json:"author"`
 	Gravatar    string    `meddler:"gravatar"         json:"gravatar"`
 	Timestamp   string    `meddler:"timestamp"        json:"timestamp"`
 	Message     string    `meddler:"message"          json:"message"`
 
+	// Files stores a newline-separated list of the
+	// files changed by the commit, if known.
+	Files string `meddler:"files,zeroisnull" json:"-"`
+
 	Created time.Time `meddler:"created,utctime"  json:"created"`
 	Updated time.Time `meddler:"updated,utctime"  json:"updated"`
 }
@@ -33,6 +43,32 @@ func (c *Commit) HashShort() string {
 	}
 }
 
+// Returns true if the Commit status is Started
+// or Pending, indicating it is currently running.
+func (c *Commit) IsRunning() bool {
+	return (c.Status == StatusStarted || c.Status == StatusEnqueue)
+}
+
+// Returns true if the Commit is a pull request
+// that is waiting for approval.
+func (c *Commit) IsApproval() bool {
+	return c.Status == StatusApproval
+}
+
+// Returns true if the Commit was not built,
+// because the build was skipped.
+func (c *Commit) IsSkipped() bool {
+	return c.Status == StatusSkipped
+}
+
+// Returns the list of files changed by the Commit.
+func (c *Commit) FileList() []string {
+	if len(c.Files) == 0 {
+		return nil
+	}
+	return strings.Split(c.Files, "\n")
+}
+
 // Returns the Gravatar Image URL.
 func (c *Commit) Image() string      { return fmt.Sprintf(GravatarPattern, c.Gravatar, 58) }
 func (c *Commit) ImageSmall() string { return fmt.Sprintf(GravatarPattern, c.Gravatar, 32) }
@@ -28,6 +28,8 @@ const (
 	githubRepoPatternPrivate    = "git@%s:%s/%s.git"
 	bitbucketRepoPattern        = "https://bitbucket.org/%s/%s.git"
 	bitbucketRepoPatternPrivate = "git@bitbucket.org:%s/%s.git"
+	bitbucketHgPattern          = "https://bitbucket.org/%s/%s"
+	bitbucketHgPatternPrivate   = "ssh://hg@bitbucket.org/%s/%s"
 )
 
 type Repo struct {
@@ -72,12 +74,21 @@ type Repo struct {
 	// username and password requires to authenticate
 	// to the repository
 	Username string `meddler:"username" json:"username"`
-	Password string `meddler:"password" json:"password"`
+	Password string `meddler:"password" json:"-"`
 
 	// RSA key pair that will injected into the virtual machine
 	// .ssh/id_rsa and .ssh/id_rsa.pub files.
 	PublicKey  string `meddler:"public_key"  json:"public_key"`
-	PrivateKey string `meddler:"private_key" json:"public_key"`
+	PrivateKey string `meddler:"private_key" json:"-"`
+
+	// Secret used by the host to sign the hook payload,
+	// so that the hook can be verified.
+	HookSecret string `meddler:"hook_secret,zeroisnull" json:"-"`
+
+	// Indicates the hook was registered before hook secrets
+	// were supported, and must be reset so that the host signs
+	// the payload using the secret.
+	HookOutdated bool `meddler:"hook_outdated" json:"-"`
 
 	// Parameters stored external to the repository in YAML
 	// format, injected into the Build YAML at runtime.
@@ -91,6 +102,14 @@ type Repo struct {
 	// mode. This could, for example, be used to run Docker in Docker.
 	Privileged bool `meddler:"privileged" json:"privileged"`
 
+	// the memory limit, in bytes, of the build container. A
+	// value of zero indicates the build memory is not limited.
+	Memory int64 `meddler:"memory,zeroisnull" json:"memory"`
+
+	// the relative CPU weight of the build container. A value
+	// of zero indicates the Docker default should be used.
+	CpuShares int64 `meddler:"cpu_shares,zeroisnull" json:"cpu_shares"`
+
 	// Foreign keys signify the User that created
 	// the repository and team account linked to
 	// the repository.
@@ -144,6 +163,30 @@ func NewBitbucketRepo(owner, name string, private bool) (*Repo, error) {
 	return NewRepo(HostBitbucket, owner, name, ScmGit, url)
 }
 
+// Creates a new Bitbucket Mercurial repository
+func NewBitbucketHgRepo(owner, name string, private bool) (*Repo, error) {
+	var url string
+	switch private {
+	case false:
+		url = fmt.Sprintf(bitbucketHgPattern, owner, name)
+	case true:
+		url = fmt.Sprintf(bitbucketHgPatternPrivate, owner, name)
+	}
+	return NewRepo(HostBitbucket, owner, name, ScmHg, url)
+}
+
+// Creates a new repository hosted on a custom server, such
+// as Gitolite or Gogs, using the git, hg or svn clone URL.
+func NewCustomRepo(owner, name, scm, url string) (*Repo, error) {
+	return NewRepo(HostCustom, owner, name, scm, url)
+}
+
+// Generates a new secret used to sign the hook payload,
+// which invalidates the previous secret.
+func (r *Repo) ResetHookSecret() {
+	r.HookSecret = createToken()
+}
+
 func (r *Repo) DefaultBranch() string {
 	switch r.SCM {
 	case ScmGit:
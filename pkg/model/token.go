@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// Token is a named, revocable API token that
+// can be used to authenticate as a User.
+type Token struct {
+	ID     int64  `meddler:"id,pk"     json:"id"`
+	UserID int64  `meddler:"user_id"   json:"-"`
+	Name   string `meddler:"name"      json:"name"`
+	Token  string `meddler:"token"     json:"-"`
+
+	// ReadOnly indicates the token can only be used
+	// for requests that do not modify data.
+	ReadOnly bool `meddler:"read_only" json:"read_only"`
+
+	Created time.Time `meddler:"created,utctime" json:"created"`
+	Updated time.Time `meddler:"updated,utctime" json:"updated"`
+}
+
+// Creates a new Token for the given User.
+func NewToken(user int64, name string, readOnly bool) *Token {
+	token := Token{}
+	token.UserID = user
+	token.Name = name
+	token.ReadOnly = readOnly
+	token.Token = createToken()
+	return &token
+}
+
+// Returns the Created Date as an ISO8601
+// formatted string.
+func (t *Token) CreatedString() string {
+	return t.Created.Format("2006-01-02T15:04:05Z")
+}
@@ -52,6 +52,12 @@ func NewUser(name, email string) *User {
 	return &user
 }
 
+// Generates a new API token for the User, which
+// invalidates the previous token.
+func (u *User) ResetToken() {
+	u.Token = createToken()
+}
+
 // Returns the Gravatar Image URL.
 func (u *User) Image() string      { return fmt.Sprintf(GravatarPattern, u.Gravatar, 42) }
 func (u *User) ImageSmall() string { return fmt.Sprintf(GravatarPattern, u.Gravatar, 32) }
@@ -18,6 +18,9 @@ type Deploy struct {
 	Nodejitsu    *Nodejitsu    `yaml:"nodejitsu,omitempty"`
 	Openshift    *Openshift    `yaml:"openshift,omitempty"`
 	SSH          *SSH          `yaml:"ssh,omitempty"`
+
+	// Tag limits the deployment to builds of a tag.
+	Tag bool `yaml:"tag,omitempty"`
 }
 
 func (d *Deploy) Write(f *buildfile.Buildfile) {
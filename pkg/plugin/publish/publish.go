@@ -9,6 +9,9 @@ import (
 // a Build has succeeded
 type Publish struct {
 	S3 *S3 `yaml:"s3,omitempty"`
+
+	// Tag limits publishing to builds of a tag.
+	Tag bool `yaml:"tag,omitempty"`
 }
 
 func (p *Publish) Write(f *buildfile.Buildfile) {
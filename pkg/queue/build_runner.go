@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"errors"
 	"io"
 	"time"
 
@@ -10,31 +11,85 @@ import (
 	"github.com/drone/drone/pkg/build/script"
 )
 
+// ErrMergeConflict is returned by the BuildRunner when a
+// pull request can't be merged into the base branch.
+var ErrMergeConflict = errors.New("Pull request can't be merged into the base branch")
+
+// RunOptions specifies the options used to
+// execute a single build.
+type RunOptions struct {
+	// Timeout is the maximum amount of time the build
+	// may run. If zero, the runner's default is used.
+	Timeout time.Duration
+
+	// Privileged indicates the build should be executed
+	// in privileged mode.
+	Privileged bool
+
+	// Memory is the memory limit, in bytes, of the
+	// build container. If zero, there is no limit.
+	Memory int64
+
+	// CpuShares is the relative CPU weight of the build
+	// container. If zero, the Docker default is used.
+	CpuShares int64
+
+	// Mirror indicates a mirror of the repository should
+	// be kept on the host machine to speed up clones.
+	Mirror bool
+
+	// Cancel is closed when the build should be killed.
+	Cancel <-chan bool
+}
+
 type BuildRunner interface {
-	Run(buildScript *script.Build, repo *repo.Repo, key []byte, buildOutput io.Writer) (success bool, err error)
+	Run(buildScript *script.Build, repo *repo.Repo, key []byte, buildOutput io.Writer, opts *RunOptions) (success bool, err error)
 }
 
 type buildRunner struct {
 	dockerClient *docker.Client
 	timeout      time.Duration
+
+	// mount indicates the builds are run without
+	// creating a build image.
+	mount bool
 }
 
-func NewBuildRunner(dockerClient *docker.Client, timeout time.Duration) BuildRunner {
+func NewBuildRunner(dockerClient *docker.Client, timeout time.Duration, mount bool) BuildRunner {
 	return &buildRunner{
 		dockerClient: dockerClient,
 		timeout:      timeout,
+		mount:        mount,
 	}
 }
 
-func (runner *buildRunner) Run(buildScript *script.Build, repo *repo.Repo, key []byte, buildOutput io.Writer) (bool, error) {
+func (runner *buildRunner) Run(buildScript *script.Build, repo *repo.Repo, key []byte, buildOutput io.Writer, opts *RunOptions) (bool, error) {
 	builder := build.New(runner.dockerClient)
 	builder.Build = buildScript
 	builder.Repo = repo
 	builder.Key = key
 	builder.Stdout = buildOutput
 	builder.Timeout = runner.timeout
+	builder.Privileged = opts.Privileged
+	builder.Memory = opts.Memory
+	builder.CpuShares = opts.CpuShares
+	builder.Mirror = opts.Mirror
+	builder.Mount = runner.mount
+	builder.Cancel = opts.Cancel
+
+	// the repository timeout takes precedence
+	// over the default timeout.
+	if opts.Timeout > 0 {
+		builder.Timeout = opts.Timeout
+	}
 
 	err := builder.Run()
 
+	// the build reports when the pull request can't
+	// be merged into the base branch.
+	if err == nil && builder.BuildState != nil && builder.BuildState.MergeConflict {
+		err = ErrMergeConflict
+	}
+
 	return builder.BuildState == nil || builder.BuildState.ExitCode != 0, err
 }
@@ -1,13 +1,35 @@
 package queue
 
 import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/drone/drone/pkg/build/script"
+	"github.com/drone/drone/pkg/channel"
+	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
 )
 
-// A Queue dispatches tasks to workers.
+// pollInterval is the interval at which idle workers
+// check the database for Pending builds, in case they
+// missed a signal from the queue.
+var pollInterval = 30 * time.Second
+
+// A Queue dispatches tasks to workers. Tasks are persisted
+// to the database as Pending builds, which ensures they
+// are not lost if the server is restarted.
 type Queue struct {
-	tasks chan<- *BuildTask
+	sync.Mutex
+
+	// signal notifies idle workers that
+	// tasks were added to the queue.
+	signal chan bool
+
+	// running stores a channel for each running
+	// build, used to kill the build.
+	running map[int64]chan bool
 }
 
 // BuildTasks represents a build that is pending
@@ -20,26 +42,255 @@ type BuildTask struct {
 	// Build instructions from the .drone.yml
 	// file, unmarshalled.
 	Script *script.Build
+
+	// cancel is closed when the build
+	// should be killed.
+	cancel chan bool
 }
 
 // Start N workers with the given build runner.
 func Start(workers int, runner BuildRunner) *Queue {
-	tasks := make(chan *BuildTask)
+	queue := &Queue{
+		signal:  make(chan bool, workers),
+		running: make(map[int64]chan bool),
+	}
 
-	queue := &Queue{tasks: tasks}
+	// recover any builds that were interrupted
+	// the last time the server was stopped.
+	if err := recoverBuilds(); err != nil {
+		log.Printf("error recovering builds: %s\n", err.Error())
+	}
 
 	for i := 0; i < workers; i++ {
 		worker := worker{
 			runner: runner,
 		}
 
-		go worker.work(tasks)
+		go worker.work(queue)
 	}
 
 	return queue
 }
 
-// Add adds the task to the build queue.
-func (q *Queue) Add(task *BuildTask) {
-	q.tasks <- task
+// Add adds the tasks to the build queue. The tasks
+// are persisted to the database before any idle
+// workers are notified.
+func (q *Queue) Add(tasks ...*BuildTask) error {
+	for _, task := range tasks {
+		// the raw build configuration is stored, so that
+		// the repository params are never persisted.
+		task.Build.Status = "Pending"
+		task.Build.Config = string(task.Script.Raw)
+		if err := database.SaveBuild(task.Build); err != nil {
+			return err
+		}
+	}
+
+	for _ = range tasks {
+		q.notify()
+	}
+
+	return nil
+}
+
+// List returns the list of tasks that are Pending
+// or Started, in the order they were added.
+func (q *Queue) List() ([]*BuildTask, error) {
+	builds, err := database.ListBuildsQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*BuildTask
+	for _, build := range builds {
+		commit, err := database.GetCommit(build.CommitID)
+		if err != nil {
+			return nil, err
+		}
+		repo, err := database.GetRepo(commit.RepoID)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &BuildTask{Repo: repo, Commit: commit, Build: build})
+	}
+
+	return tasks, nil
+}
+
+// Cancel kills the build with the given ID. If the build
+// is running it is stopped, otherwise it is removed from the
+// queue. This can also be used to remove a build that is
+// stuck in the queue.
+func (q *Queue) Cancel(id int64) error {
+	q.Lock()
+	defer q.Unlock()
+
+	// if the build is running, notify the worker. The
+	// worker is responsible for updating the status.
+	if cancel, ok := q.running[id]; ok {
+		delete(q.running, id)
+		close(cancel)
+		return nil
+	}
+
+	build, err := database.GetBuild(id)
+	if err != nil {
+		return err
+	}
+
+	// the build is already finished
+	if build.Status != "Pending" && build.Status != "Started" {
+		return nil
+	}
+
+	commit, err := database.GetCommit(build.CommitID)
+	if err != nil {
+		return err
+	}
+
+	repo, err := database.GetRepo(commit.RepoID)
+	if err != nil {
+		return err
+	}
+
+	build.Status = "Killed"
+	build.Finished = time.Now().UTC()
+	if err := database.SaveBuild(build); err != nil {
+		return err
+	}
+
+	if _, err := updateCommit(commit); err != nil {
+		return err
+	}
+
+	// notify the channels that the commit and build changed
+	reposlug := fmt.Sprintf("%s/%s/%s", repo.Host, repo.Owner, repo.Name)
+	commitslug := fmt.Sprintf("%s/%s/%s/commit/%s", repo.Host, repo.Owner, repo.Name, commit.Hash)
+	channel.SendJSON(reposlug, commit)
+	channel.SendJSON(commitslug, build)
+	return nil
+}
+
+// notify wakes up an idle worker, if any. The signal
+// is dropped if all workers are busy, since they check
+// for Pending builds before going idle.
+func (q *Queue) notify() {
+	select {
+	case q.signal <- true:
+	default:
+	}
+}
+
+// next claims the next Pending build from the database
+// and returns the task for execution.
+func (q *Queue) next() (*BuildTask, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	build, err := database.ClaimBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := database.GetCommit(build.CommitID)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := database.GetRepo(commit.RepoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the repository params are never injected into pull
+	// requests, since the build script can't be trusted.
+	params := repo.Params
+	if len(commit.PullRequest) != 0 {
+		params = nil
+	}
+
+	// the build was claimed, so if the build instructions
+	// can't be parsed we need to mark it as an error to
+	// prevent it from being stuck in a Started state.
+	buildscript, err := parseBuildConfig(build, params)
+	if err != nil || len(build.Config) == 0 {
+		if err := errorBuild(commit, build, "Could not parse the build instructions.\n"); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not parse the build instructions for build %d", build.ID)
+	}
+
+	// register the build as running so that
+	// it can be killed.
+	cancel := make(chan bool)
+	q.running[build.ID] = cancel
+
+	return &BuildTask{Repo: repo, Commit: commit, Build: build, Script: buildscript, cancel: cancel}, nil
+}
+
+// done removes the task from the list of running builds.
+func (q *Queue) done(task *BuildTask) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.running, task.Build.ID)
+}
+
+// recoverBuilds inspects the database for builds that
+// were interrupted because the server was stopped. Started
+// builds are marked as an Error, and Pending builds will
+// be picked up by the workers.
+func recoverBuilds() error {
+	builds, err := database.ListBuildsQueue()
+	if err != nil {
+		return err
+	}
+
+	for _, build := range builds {
+		if build.Status != "Started" {
+			continue
+		}
+
+		commit, err := database.GetCommit(build.CommitID)
+		if err != nil {
+			return err
+		}
+
+		msg := "Build was interrupted because the server was restarted.\n"
+		if err := errorBuild(commit, build, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseBuildConfig is a helper function that parses the
+// stored build configuration, injecting the repository
+// params, and returns the build for the matrix axis.
+func parseBuildConfig(build *Build, params map[string]string) (*script.Build, error) {
+	buildscript, err := script.ParseBuild([]byte(build.Config), params)
+	if err != nil {
+		return nil, err
+	}
+
+	builds := buildscript.Builds()
+	if build.Axis >= len(builds) {
+		return nil, fmt.Errorf("build matrix has no axis %d", build.Axis)
+	}
+	return builds[build.Axis], nil
+}
+
+// errorBuild is a helper function that marks a build that
+// will never be executed as an Error, and updates the
+// commit status accordingly.
+func errorBuild(commit *Commit, build *Build, msg string) error {
+	build.Status = "Error"
+	build.Finished = time.Now().UTC()
+	build.Stdout = build.Stdout + msg
+	if err := database.SaveBuild(build); err != nil {
+		return err
+	}
+
+	_, err := updateCommit(commit)
+	return err
 }
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"github.com/drone/drone/pkg/build/git"
 	r "github.com/drone/drone/pkg/build/repo"
@@ -9,10 +10,13 @@ import (
 	"github.com/drone/drone/pkg/database"
 	. "github.com/drone/drone/pkg/model"
 	"github.com/drone/drone/pkg/plugin/notify"
+	"github.com/drone/go-bitbucket/oauth1"
 	"github.com/drone/go-github/github"
 	"io"
 	"log"
-	"path/filepath"
+	"net/http"
+	"net/url"
+	"sync"
 	"time"
 )
 
@@ -23,17 +27,28 @@ type worker struct {
 // work is a function that will infinitely
 // run in the background waiting for tasks that
 // it can pull off the queue and execute.
-func (w *worker) work(queue <-chan *BuildTask) {
-	var task *BuildTask
+func (w *worker) work(queue *Queue) {
 	for {
-		// get work item (pointer) from the queue
-		task = <-queue
-		if task == nil {
+		// claim the next Pending build
+		task, err := queue.next()
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("error getting build from queue: %s\n", err.Error())
+			}
+
+			// wait until we are notified that a task
+			// was added to the queue, or until the
+			// poll interval elapses.
+			select {
+			case <-queue.signal:
+			case <-time.After(pollInterval):
+			}
 			continue
 		}
 
 		// execute the task
 		w.execute(task)
+		queue.done(task)
 	}
 }
 
@@ -46,29 +61,27 @@ func (w *worker) execute(task *BuildTask) error {
 	defer func() {
 		if e := recover(); e != nil {
 			task.Build.Finished = time.Now().UTC()
-			task.Commit.Finished = time.Now().UTC()
 			task.Build.Duration = task.Build.Finished.Unix() - task.Build.Started.Unix()
-			task.Commit.Duration = task.Build.Finished.Unix() - task.Build.Started.Unix()
-			task.Commit.Status = "Error"
 			task.Build.Status = "Error"
 			database.SaveBuild(task.Build)
-			database.SaveCommit(task.Commit)
+			updateCommit(task.Commit)
 		}
 	}()
 
-	// update commit and build status
-	task.Commit.Status = "Started"
+	// update the build status. the status is already
+	// Started, since the build was claimed from the queue.
 	task.Build.Status = "Started"
 	task.Build.Started = time.Now().UTC()
-	task.Commit.Started = time.Now().UTC()
 
-	// persist the commit to the database
-	if err := database.SaveCommit(task.Commit); err != nil {
+	// persist the build to the database
+	if err := database.SaveBuild(task.Build); err != nil {
 		return err
 	}
 
-	// persist the build to the database
-	if err := database.SaveBuild(task.Build); err != nil {
+	// update the commit status. the commit may already
+	// be started if this is part of a build matrix.
+	started, err := startCommit(task.Commit)
+	if err != nil {
 		return err
 	}
 
@@ -82,14 +95,17 @@ func (w *worker) execute(task *BuildTask) error {
 		Host:   settings.URL().String(),
 	}
 
-	// send all "started" notifications
-	if task.Script.Notifications != nil {
-		task.Script.Notifications.Send(context)
-	}
+	// send all "started" notifications, but only
+	// for the first build in the matrix
+	if started {
+		if task.Script.Notifications != nil {
+			task.Script.Notifications.Send(context)
+		}
 
-	// Send "started" notification to Github
-	if err := updateGitHubStatus(task.Repo, task.Commit); err != nil {
-		log.Printf("error updating github status: %s\n", err.Error())
+		// Send "started" notification to the repository host
+		if err := updateStatus(task.Repo, task.Commit); err != nil {
+			log.Printf("error updating %s status: %s\n", task.Repo.Host, err.Error())
+		}
 	}
 
 	// make sure a channel exists for the repository,
@@ -116,28 +132,16 @@ func (w *worker) execute(task *BuildTask) error {
 		}
 	}
 
-	defer func() {
-		// update the status of the commit using the
-		// GitHub status API.
-		if err := updateGitHubStatus(task.Repo, task.Commit); err != nil {
-			log.Printf("error updating github status: %s\n", err.Error())
-		}
-	}()
-
 	// execute the build
 	passed, buildErr := w.runBuild(task, buf)
 
 	task.Build.Finished = time.Now().UTC()
-	task.Commit.Finished = time.Now().UTC()
 	task.Build.Duration = task.Build.Finished.UnixNano() - task.Build.Started.UnixNano()
-	task.Commit.Duration = task.Build.Finished.UnixNano() - task.Build.Started.UnixNano()
-	task.Commit.Status = "Success"
 	task.Build.Status = "Success"
 	task.Build.Stdout = buf.buf.String()
 
 	// if exit code != 0 set to failure
 	if passed {
-		task.Commit.Status = "Failure"
 		task.Build.Status = "Failure"
 		if buildErr != nil && task.Build.Stdout == "" {
 			// TODO: If you wanted to have very friendly error messages, you could do that here
@@ -145,13 +149,29 @@ func (w *worker) execute(task *BuildTask) error {
 		}
 	}
 
+	// if the pull request could not be merged, override
+	// the status to distinguish it from a failed build
+	if buildErr == ErrMergeConflict {
+		task.Build.Status = "Conflict"
+	}
+
+	// if the build was killed, override the status
+	select {
+	case <-task.cancel:
+		task.Build.Status = "Killed"
+		task.Build.Stdout = task.Build.Stdout + "Build was killed.\n"
+	default:
+	}
+
 	// persist the build to the database
 	if err := database.SaveBuild(task.Build); err != nil {
 		return err
 	}
 
-	// persist the commit to the database
-	if err := database.SaveCommit(task.Commit); err != nil {
+	// update the commit status to reflect the status
+	// of all builds in the matrix.
+	finished, err := updateCommit(task.Commit)
+	if err != nil {
 		return err
 	}
 
@@ -160,6 +180,18 @@ func (w *worker) execute(task *BuildTask) error {
 	channel.SendJSON(commitslug, task.Build)
 	channel.Close(consoleslug)
 
+	// the remaining notifications are only sent once
+	// all builds in the matrix have completed.
+	if !finished {
+		return nil
+	}
+
+	// update the status of the commit using the
+	// GitHub or Bitbucket status API.
+	if err := updateStatus(task.Repo, task.Commit); err != nil {
+		log.Printf("error updating %s status: %s\n", task.Repo.Host, err.Error())
+	}
+
 	// send all "finished" notifications
 	if task.Script.Notifications != nil {
 		task.Script.Notifications.Send(context)
@@ -174,19 +206,138 @@ func (w *worker) runBuild(task *BuildTask, buf io.Writer) (bool, error) {
 		Path:   task.Repo.URL,
 		Branch: task.Commit.Branch,
 		Commit: task.Commit.Hash,
+		Tag:    task.Commit.Tag,
+		Files:  task.Commit.FileList(),
 		PR:     task.Commit.PullRequest,
-		Dir:    filepath.Join("/var/cache/drone/src", task.Repo.Slug),
+		Dir:    git.GitPath(task.Script.Git, task.Repo.Slug),
 		Depth:  git.GitDepth(task.Script.Git),
+		Scm:    task.Repo.SCM,
+
+		NoSubmodules: !git.GitSubmodules(task.Script.Git),
+		Tags:         git.GitTags(task.Script.Git),
+
+		BaseBranch: task.Commit.BaseBranch,
+		BaseCommit: task.Commit.BaseHash,
+		Merge:      git.GitMerge(task.Script.Git),
+	}
+
+	// privileged mode is never enabled for pull
+	// requests, for security purposes.
+	opts := &RunOptions{
+		Timeout:    time.Duration(task.Repo.Timeout) * time.Second,
+		Privileged: task.Repo.Privileged && len(task.Commit.PullRequest) == 0,
+		Memory:     task.Repo.Memory,
+		CpuShares:  task.Repo.CpuShares,
+		Cancel:     task.cancel,
+		Mirror:     true,
+	}
+
+	// the deploy key is never added to the build
+	// for untrusted pull requests, for security
+	// purposes.
+	key := []byte(task.Repo.PrivateKey)
+	if task.Commit.Untrusted {
+		key = nil
 	}
 
 	return w.runner.Run(
 		task.Script,
 		repo,
-		[]byte(task.Repo.PrivateKey),
+		key,
 		buf,
+		opts,
 	)
 }
 
+// commitMutex guards updates to the commit status,
+// since multiple builds in the matrix may complete
+// concurrently.
+var commitMutex sync.Mutex
+
+// startCommit is a helper function that will set the
+// commit status to Started. It returns true if this is
+// the first build of the commit to start.
+func startCommit(commit *Commit) (bool, error) {
+	commitMutex.Lock()
+	defer commitMutex.Unlock()
+
+	stored, err := database.GetCommit(commit.ID)
+	if err != nil {
+		return false, err
+	}
+	if stored.Status == "Started" {
+		commit.Status = stored.Status
+		commit.Started = stored.Started
+		return false, nil
+	}
+
+	commit.Status = "Started"
+	commit.Started = time.Now().UTC()
+	return true, database.SaveCommit(commit)
+}
+
+// updateCommit is a helper function that will compute the
+// commit status from the status of its builds for the most
+// recent attempt. It returns true if all builds are finished.
+func updateCommit(commit *Commit) (bool, error) {
+	commitMutex.Lock()
+	defer commitMutex.Unlock()
+
+	builds, err := database.ListBuilds(commit.ID)
+	if err != nil {
+		return false, err
+	}
+
+	status := "Success"
+	for _, build := range builds {
+		// ignore builds from previous attempts,
+		// since the commit was restarted.
+		if build.Attempt != commit.Attempts {
+			continue
+		}
+
+		switch build.Status {
+		case "Pending", "Started":
+			// at least one build is still running, so
+			// the commit status remains unchanged.
+			return false, nil
+		case "Failure":
+			status = "Failure"
+		case "Conflict":
+			if status != "Failure" {
+				status = "Conflict"
+			}
+		case "Error":
+			if status != "Failure" && status != "Conflict" {
+				status = "Error"
+			}
+		case "Killed":
+			if status == "Success" {
+				status = "Killed"
+			}
+		}
+	}
+
+	commit.Status = status
+	commit.Finished = time.Now().UTC()
+	commit.Duration = commit.Finished.UnixNano() - commit.Started.UnixNano()
+	return true, database.SaveCommit(commit)
+}
+
+// updateStatus is a helper function that will send the
+// build status to the host of the repository.
+func updateStatus(repo *Repo, commit *Commit) error {
+	switch repo.Host {
+	case HostBitbucket:
+		return updateBitbucketStatus(repo, commit)
+	case HostCustom:
+		// custom git servers do not have a status API
+		return nil
+	default:
+		return updateGitHubStatus(repo, commit)
+	}
+}
+
 // updateGitHubStatus is a helper function that will send
 // the build status to GitHub using the Status API.
 // see https://github.com/blog/1227-commit-status-api
@@ -201,9 +352,15 @@ func updateGitHubStatus(repo *Repo, commit *Commit) error {
 	case "Failure":
 		status = "failure"
 		message = "The build failed on drone.io"
+	case "Conflict":
+		status = "failure"
+		message = "The pull request has merge conflicts on drone.io"
 	case "Started":
 		status = "pending"
 		message = "The build is pending on drone.io"
+	case "Killed":
+		status = "error"
+		message = "The build was killed on drone.io"
 	default:
 		status = "error"
 		message = "The build errored on drone.io"
@@ -228,6 +385,72 @@ func updateGitHubStatus(repo *Repo, commit *Commit) error {
 	return client.Repos.CreateStatus(repo.Owner, repo.Name, status, url, message, commit.Hash)
 }
 
+// updateBitbucketStatus is a helper function that will send
+// the build status to Bitbucket using the Status API.
+// see https://confluence.atlassian.com/display/BITBUCKET/statuses+Resource
+func updateBitbucketStatus(repo *Repo, commit *Commit) error {
+
+	// convert from drone status to bitbucket status
+	var message, state string
+	switch commit.Status {
+	case "Success":
+		state = "SUCCESSFUL"
+		message = "The build succeeded on drone.io"
+	case "Failure":
+		state = "FAILED"
+		message = "The build failed on drone.io"
+	case "Conflict":
+		state = "FAILED"
+		message = "The pull request has merge conflicts on drone.io"
+	case "Started":
+		state = "INPROGRESS"
+		message = "The build is pending on drone.io"
+	case "Killed":
+		state = "STOPPED"
+		message = "The build was killed on drone.io"
+	default:
+		state = "FAILED"
+		message = "The build errored on drone.io"
+	}
+
+	// get the system settings
+	settings, _ := database.GetSettings()
+
+	// get the user from the database
+	// since we need his / her Bitbucket token
+	user, err := database.GetUser(repo.UserID)
+	if err != nil {
+		return err
+	}
+
+	// the Bitbucket client doesn't support the Status
+	// API, so the request is signed by the consumer.
+	consumer := oauth1.Consumer{
+		ConsumerKey:    settings.BitbucketKey,
+		ConsumerSecret: settings.BitbucketSecret,
+	}
+	token := oauth1.NewAccessToken(user.BitbucketToken, user.BitbucketSecret, nil)
+
+	params := url.Values{}
+	params.Set("state", state)
+	params.Set("key", "drone")
+	params.Set("name", "drone")
+	params.Set("url", settings.URL().String()+"/"+repo.Slug+"/commit/"+commit.Hash)
+	params.Set("description", message)
+
+	endpoint := fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%s/%s/commit/%s/statuses/build", repo.Owner, repo.Name, commit.Hash)
+	resp, err := consumer.Post(endpoint, params, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("Unable to update the status of commit %s. %s", commit.HashShort(), resp.Status)
+	}
+	return nil
+}
+
 type bufferWrapper struct {
 	buf bytes.Buffer
 
@@ -63,6 +63,7 @@ func init() {
 		"user_delete.html",
 		"user_teams.html",
 		"user_teams_add.html",
+		"user_tokens.html",
 		"team_dashboard.html",
 		"team_profile.html",
 		"team_members.html",
@@ -80,7 +81,11 @@ func init() {
 		"admin_users_edit.html",
 		"admin_users_add.html",
 		"admin_settings.html",
+		"admin_queue.html",
 		"github_add.html",
+		"bitbucket_link.html",
+		"bitbucket_add.html",
+		"custom_add.html",
 		"github_link.html",
 	}
 